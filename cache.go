@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// SelectUsers の結果を ttl の間だけメモリに持っておく
+// 書き込んだ直後に最新の値が欲しい場合は Invalidate を呼ぶ
+type CachedUserSelector struct {
+	db  sqlx.ExtContext
+	ttl time.Duration
+
+	mu        sync.RWMutex
+	users     []User
+	fetchedAt time.Time
+}
+
+func NewCachedUserSelector(db sqlx.ExtContext, ttl time.Duration) *CachedUserSelector {
+	return &CachedUserSelector{db: db, ttl: ttl}
+}
+
+// 返すスライスは呼び出し元が書き換えてもキャッシュに影響しない
+func (c *CachedUserSelector) SelectUsers(ctx context.Context) ([]User, error) {
+	c.mu.RLock()
+	if c.fresh() {
+		users := slices.Clone(c.users)
+		c.mu.RUnlock()
+		return users, nil
+	}
+	c.mu.RUnlock()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// ロックを待っている間に他の goroutine が取り直しているかもしれない
+	if c.fresh() {
+		return slices.Clone(c.users), nil
+	}
+	users, err := SelectUsers(ctx, c.db)
+	if err != nil {
+		return nil, fmt.Errorf("CachedUserSelector.SelectUsers: %w", err)
+	}
+	c.users, c.fetchedAt = users, time.Now()
+	return slices.Clone(users), nil
+}
+
+// 次の SelectUsers で必ず DB に問い合わせるようにする
+func (c *CachedUserSelector) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.users, c.fetchedAt = nil, time.Time{}
+}
+
+// c.mu を取った状態で呼ぶ
+func (c *CachedUserSelector) fresh() bool {
+	return c.users != nil && time.Since(c.fetchedAt) < c.ttl
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCachedUserSelectorTTL(t *testing.T) {
+	const ttl = 50 * time.Millisecond
+	c := NewCachedUserSelector(newSeededTestDB(t), ttl)
+	ctx := context.Background()
+
+	// カウンタはパッケージ全体で共有しているので差分で確かめる
+	before := Metrics().QueriesTotal
+	queries := func() int64 { return Metrics().QueriesTotal - before }
+
+	for range 2 {
+		users, err := c.SelectUsers(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(users) != 3 {
+			t.Fatalf("SelectUsers = %v, want 3 users", users)
+		}
+	}
+	if got := queries(); got != 1 {
+		t.Errorf("queries within the TTL = %d, want 1", got)
+	}
+
+	time.Sleep(ttl + 10*time.Millisecond)
+	if _, err := c.SelectUsers(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := queries(); got != 2 {
+		t.Errorf("queries after the TTL = %d, want 2", got)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// 書き込みは primary, 読み込みは replica に振り分ける
+// replica はラウンドロビンで選ぶ. replica がなければ読み込みも primary に投げる
+//
+// replica への反映は遅れることがあるので, 書いた直後に読み直す場合は Primary() を直接使う
+type Cluster struct {
+	primary  *sqlx.DB
+	replicas []*sqlx.DB
+	next     atomic.Uint64
+}
+
+func NewCluster(primary *sqlx.DB, replicas ...*sqlx.DB) *Cluster {
+	return &Cluster{primary: primary, replicas: replicas}
+}
+
+func (c *Cluster) Primary() *sqlx.DB {
+	return c.primary
+}
+
+// 呼ぶたびに次の replica を返す
+func (c *Cluster) Replica() *sqlx.DB {
+	if len(c.replicas) == 0 {
+		return c.primary
+	}
+	n := c.next.Add(1) - 1
+	return c.replicas[n%uint64(len(c.replicas))]
+}
+
+// 全ての接続を閉じる. 途中で失敗しても残りは閉じる
+func (c *Cluster) Close() error {
+	errs := []error{c.primary.Close()}
+	for _, r := range c.replicas {
+		errs = append(errs, r.Close())
+	}
+	return errors.Join(errs...)
+}
+
+func (c *Cluster) SelectUsers(ctx context.Context) ([]User, error) {
+	return SelectUsers(ctx, c.Replica())
+}
+
+func (c *Cluster) InQuery(ctx context.Context, userIDs []int) ([]User, error) {
+	return InQuery(ctx, c.Replica(), userIDs)
+}
+
+func (c *Cluster) JoinQuery(ctx context.Context) ([]UserPostJoin, error) {
+	return JoinQuery(ctx, c.Replica())
+}
+
+func (c *Cluster) BulkInsert(ctx context.Context, users []User, posts []Post) (int64, int64, error) {
+	return BulkInsert(ctx, c.primary, users, posts)
+}
+
+func (c *Cluster) UpdateUser(ctx context.Context, u User) (int64, error) {
+	return UpdateUser(ctx, c.primary, u)
+}
+
+func (c *Cluster) DeleteUser(ctx context.Context, id int) error {
+	return DeleteUser(ctx, c.primary, id)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestClusterRouting(t *testing.T) {
+	ctx := context.Background()
+	primary := newTestDB(t)
+	// どの DB から読んだか分かるように, replica ごとに別の user を入れておく
+	replicas := []string{"replica1", "replica2"}
+	c := NewCluster(primary, newTestDB(t), newTestDB(t))
+	for i, r := range c.replicas {
+		if _, err := CreateUser(ctx, r, replicas[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var got []string
+	for range 4 {
+		users, err := c.SelectUsers(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, userNames(users)...)
+	}
+	if want := []string{"replica1", "replica2", "replica1", "replica2"}; !slices.Equal(got, want) {
+		t.Errorf("reads went to %v, want %v", got, want)
+	}
+
+	if _, _, err := c.BulkInsert(ctx, []User{{Name: "Dave"}, {Name: "Eve"}}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DeleteUser(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	users, err := SelectUsers(ctx, c.Primary())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := userNames(users), []string{"Eve"}; !slices.Equal(got, want) {
+		t.Errorf("primary users = %v, want %v", got, want)
+	}
+	// DeleteUser(1) が replica に行っていれば消えている
+	for i, r := range c.replicas {
+		if count, err := CountUsers(ctx, r); err != nil || count != 1 {
+			t.Errorf("replica %d CountUsers = %d, %v, want 1", i+1, count, err)
+		}
+	}
+}
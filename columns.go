@@ -0,0 +1,92 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/jmoiron/sqlx/reflectx"
+	"github.com/samber/lo"
+)
+
+// InitDB で設定するものと同じく, db タグがなければフィールド名を snake_case にしたものをカラム名にする
+var columnMapper = reflectx.NewMapperFunc("db", toSnakeCase)
+
+var scannerType = reflect.TypeFor[sql.Scanner]()
+
+// T の db タグからカラム名をフィールドの定義順に返す
+// タグ付きで埋め込んだ構造体は "user.id" のように sqlx が Scan するときと同じ名前になる
+func Columns[T any]() []string {
+	tm := columnMapper.TypeMap(reflect.TypeFor[T]())
+	var columns []string
+	var walk func(fi *reflectx.FieldInfo)
+	walk = func(fi *reflectx.FieldInfo) {
+		// sql.Null[T] のような Scanner や, time.Time のように公開フィールドを持たない構造体は 1 つのカラムとして扱う
+		children := lo.Compact(fi.Children)
+		if len(children) == 0 || reflect.PointerTo(reflectx.Deref(fi.Field.Type)).Implements(scannerType) {
+			columns = append(columns, fi.Path)
+			return
+		}
+		for _, c := range children {
+			walk(c)
+		}
+	}
+	for _, fi := range lo.Compact(tm.Tree.Children) {
+		walk(fi)
+	}
+	return columns
+}
+
+// "users.id, users.name" のようにテーブル名 (か別名) で修飾して並べる
+func qualifiedColumns(table string, columns []string) string {
+	return strings.Join(lo.Map(columns, func(c string, _ int) string { return table + "." + c }), ", ")
+}
+
+// :name 形式の INSERT を組み立てる
+func buildInsertQuery(table string, columns []string) string {
+	return "INSERT INTO " + table + " (" + strings.Join(columns, ", ") + ") VALUES (" + namedPlaceholders(columns) + ")"
+}
+
+func namedPlaceholders(columns []string) string {
+	return strings.Join(lo.Map(columns, func(c string, _ int) string { return ":" + c }), ", ")
+}
+
+// fields のキーをカラム名として, 並べ替えて返す
+// カラム名は SQL に埋め込むので, allowed にないキーがあればエラーにする
+// map の順序は毎回変わるので, 同じキーなら同じ SQL になるように並べる
+func allowedColumns(fields map[string]any, allowed map[string]bool) ([]string, error) {
+	columns := lo.Keys(fields)
+	slices.Sort(columns)
+	for _, c := range columns {
+		if !allowed[c] {
+			return nil, fmt.Errorf("invalid column: %q", c)
+		}
+	}
+	return columns, nil
+}
+
+// UserID -> user_id, CreatedAt -> created_at, HTTPServer -> http_server
+// 連続した大文字は 1 つの単語 (略語) として扱う
+func toSnakeCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if !unicode.IsUpper(r) {
+			b.WriteRune(r)
+			continue
+		}
+		if i > 0 {
+			prev := runes[i-1]
+			// 小文字や数字の後, または略語の終わり (HTTPServer の S) で区切る
+			nextIsLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextIsLower) {
+				b.WriteByte('_')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
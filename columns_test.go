@@ -0,0 +1,37 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestColumns(t *testing.T) {
+	// 構造体の定義順に並ぶ
+	want := []string{"id", "user_id", "content", "status", "metadata", "created_at", "updated_at"}
+	if got := Columns[Post](); !slices.Equal(got, want) {
+		t.Errorf("Columns[Post]() = %v, want %v", got, want)
+	}
+}
+
+func TestSnakeCaseMapper(t *testing.T) {
+	db := newSeededTestDB(t)
+
+	// db タグのないフィールド
+	var rows []struct {
+		ID        int
+		CreatedAt time.Time
+	}
+	if err := db.Select(&rows, "SELECT id, created_at FROM users ORDER BY id"); err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 || rows[0].CreatedAt.IsZero() {
+		t.Errorf("rows = %+v, want created_at scanned", rows)
+	}
+
+	for name, want := range map[string]string{"CreatedAt": "created_at", "UserID": "user_id", "HTTPServer": "http_server"} {
+		if got := toSnakeCase(name); got != want {
+			t.Errorf("toSnakeCase(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// UNIQUE 制約に違反したことを表す
+// API 層では errors.As で取り出して 409 Conflict にするといい
+type ConflictError struct {
+	// 重複したカラム名
+	Field string
+	// ドライバが返した元のエラー
+	Err error
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("%s already exists", e.Field)
+}
+
+func (e *ConflictError) Unwrap() error {
+	return e.Err
+}
+
+// UNIQUE 制約違反なら *ConflictError に包み, それ以外はそのまま返す
+func asConflictError(err error) error {
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) || sqliteErr.ExtendedCode != sqlite3.ErrConstraintUnique {
+		return err
+	}
+	// メッセージは "UNIQUE constraint failed: users.name" の形
+	// 複合 UNIQUE の場合は "users.a, users.b" になるので, 先頭のカラムを使う
+	field := sqliteErr.Error()
+	if _, after, ok := strings.Cut(field, ": "); ok {
+		field = after
+	}
+	field, _, _ = strings.Cut(field, ",")
+	if _, column, ok := strings.Cut(field, "."); ok {
+		field = column
+	}
+	return &ConflictError{Field: field, Err: err}
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestCreateUserConflict(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+
+	if _, err := CreateUser(ctx, db, "Alice"); err != nil {
+		t.Fatal(err)
+	}
+	_, err := CreateUser(ctx, db, "Alice")
+	var conflict *ConflictError
+	if !errors.As(err, &conflict) {
+		t.Fatalf("CreateUser error = %v, want *ConflictError", err)
+	}
+	if conflict.Field != "name" {
+		t.Errorf("Field = %q, want %q", conflict.Field, "name")
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// name のカウンタに delta を足して, 足した後の値を返す
+// name のカウンタがなければ 0 から始める
+// 読んでから書くと同時に呼ばれたときに更新が失われるので, 1 つの UPSERT で足して RETURNING で受け取る
+func IncrementCounter(ctx context.Context, db *sqlx.DB, name string, delta int) (int, error) {
+	var value int
+	err := WithTx(ctx, db, func(tx *sqlx.Tx) error {
+		query := `
+			INSERT INTO {counters} (name, value) VALUES (?, ?)
+			ON CONFLICT(name) DO UPDATE SET value = {counters}.value + excluded.value
+			RETURNING value
+		`
+		return getContext(ctx, tx, &value, query, name, delta)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("IncrementCounter: %w", err)
+	}
+	return value, nil
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+func TestIncrementCounterConcurrent(t *testing.T) {
+	// 接続ごとに別々の DB にならないようにファイルを使う
+	db := newFileTestDB(t)
+	ctx := context.Background()
+	deltas := []int{1, 2, 3}
+
+	var wg sync.WaitGroup
+	for _, d := range deltas {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := IncrementCounter(ctx, db, "views", d); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	value, err := IncrementCounter(ctx, db, "views", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != 6 {
+		t.Errorf("views = %d, want 6", value)
+	}
+}
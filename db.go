@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/mattn/go-sqlite3"
+)
+
+// 呼び出し元が deadline のない context を渡した場合に使うタイムアウト
+var DefaultQueryTimeout = 5 * time.Second
+
+// ctx に deadline がなければ DefaultQueryTimeout で切る
+// 既に deadline があればそちらを優先する
+func withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok || DefaultQueryTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, DefaultQueryTimeout)
+}
+
+// SQLite の PRAGMA は接続ごとの設定なので, database/sql がプールに新しい接続を作るたびに掛け直す必要がある
+// InitDB は sqlite3 のとき接続を開くたびにこれを実行する
+//   - foreign_keys: これがないと外部キー制約 (ON DELETE CASCADE を含む) を無視する
+//   - journal_mode=WAL: 書き込み中でも別の接続から読める (:memory: では memory のまま)
+//   - busy_timeout: ロックが取れないときにすぐ SQLITE_BUSY にせず待つ (ミリ秒)
+var sqlitePragmas = []string{
+	"PRAGMA foreign_keys = ON",
+	"PRAGMA journal_mode = WAL",
+	"PRAGMA busy_timeout = 5000",
+}
+
+// InitDB を通さずに sql.Open などで開く場合に, sqlitePragmas と同じ設定を DSN のパラメータで指定する
+// go-sqlite3 は DSN のパラメータを接続を開くたびに実行するので, 全接続に適用される
+// path に既にクエリ (file::memory:?cache=shared など) があれば & でつなぐ
+func SQLiteDSN(path string) string {
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	return path + sep + "_foreign_keys=on&_journal_mode=WAL&_busy_timeout=5000"
+}
+
+// go-sqlite3 の SQLiteDriver は Connector を作れないので, ConnectHook を設定したドライバで開くための Connector
+type sqliteConnector struct {
+	dsn    string
+	driver *sqlite3.SQLiteDriver
+}
+
+func (c *sqliteConnector) Connect(context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.dsn)
+}
+
+func (c *sqliteConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+// sqlx.Connect("sqlite3", dsn) と同じく Ping まで行う
+// ドライバの登録名を変えると sqlx がプレースホルダの種類を判定できなくなるので, 名前は sqlite3 のままにする
+func connectSQLite(dsn string) (*sqlx.DB, error) {
+	d := &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			for _, pragma := range sqlitePragmas {
+				if _, err := conn.Exec(pragma, nil); err != nil {
+					return fmt.Errorf("%s: %w", pragma, err)
+				}
+			}
+			return nil
+		},
+	}
+	db := sqlx.NewDb(sql.OpenDB(&sqliteConnector{dsn: dsn, driver: d}), "sqlite3")
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+type PoolConfig struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+}
+
+// ゼロ値のフィールドはこの値で埋める
+var DefaultPoolConfig = PoolConfig{
+	MaxOpenConns:    10,
+	MaxIdleConns:    5,
+	ConnMaxLifetime: 30 * time.Minute,
+}
+
+func ConfigurePool(db *sqlx.DB, cfg PoolConfig) {
+	if cfg.MaxOpenConns == 0 {
+		cfg.MaxOpenConns = DefaultPoolConfig.MaxOpenConns
+	}
+	if cfg.MaxIdleConns == 0 {
+		cfg.MaxIdleConns = DefaultPoolConfig.MaxIdleConns
+	}
+	if cfg.ConnMaxLifetime == 0 {
+		cfg.ConnMaxLifetime = DefaultPoolConfig.ConnMaxLifetime
+	}
+
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	// MaxOpenConns より大きくしても MaxOpenConns に切り詰められる
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+}
+
+// InitDB の時点で Ping は通っているが, その後に接続が切れることもあるので readiness probe 用に使う
+func HealthCheck(ctx context.Context, db *sqlx.DB) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	if err := db.PingContext(ctx); err != nil {
+		return fmt.Errorf("database is unreachable: %w", err)
+	}
+	return nil
+}
+
+// Close を何度呼んでも実際に閉じるのは 1 回だけにする
+// 2 回目以降は 1 回目と同じエラーを返す
+type SafeDB struct {
+	*sqlx.DB
+	closeOnce sync.Once
+	closeErr  error
+}
+
+func NewSafeDB(db *sqlx.DB) *SafeDB {
+	return &SafeDB{DB: db}
+}
+
+func (s *SafeDB) Close() error {
+	s.closeOnce.Do(func() {
+		s.closeErr = s.DB.Close()
+	})
+	return s.closeErr
+}
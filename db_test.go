@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func TestConfigurePool(t *testing.T) {
+	db := newTestDB(t)
+
+	ConfigurePool(db, PoolConfig{MaxOpenConns: 1})
+	if got := db.Stats().MaxOpenConnections; got != 1 {
+		t.Errorf("MaxOpenConnections = %d, want 1", got)
+	}
+}
+
+func TestHealthCheck(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+
+	if err := HealthCheck(ctx, db); err != nil {
+		t.Fatalf("HealthCheck on an open DB: %v", err)
+	}
+	db.Close()
+	if err := HealthCheck(ctx, db); err == nil {
+		t.Error("HealthCheck on a closed DB returned no error")
+	}
+}
+
+func TestDefaultQueryTimeout(t *testing.T) {
+	db := newTestDB(t)
+
+	old := DefaultQueryTimeout
+	DefaultQueryTimeout = 100 * time.Millisecond
+	t.Cleanup(func() { DefaultQueryTimeout = old })
+
+	// 終わらない再帰クエリ. ロック待ちは busy_timeout が切れるまで中断されないので, 実行中のクエリで確かめる
+	query := "WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM c) SELECT COUNT(*) FROM c"
+	start := time.Now()
+	_, err := SelectOne[int](context.Background(), db, query)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("SelectOne error = %v, want context.DeadlineExceeded", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("SelectOne took %v, want about %v", d, DefaultQueryTimeout)
+	}
+}
+
+// Exec の前に delay だけ待つ
+type slowExecDB struct {
+	sqlx.ExtContext
+	delay time.Duration
+}
+
+func (s slowExecDB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	time.Sleep(s.delay)
+	return s.ExtContext.ExecContext(ctx, query, args...)
+}
+
+func TestDefaultQueryTimeoutPerQuery(t *testing.T) {
+	db := newTestDB(t)
+
+	old := DefaultQueryTimeout
+	DefaultQueryTimeout = 200 * time.Millisecond
+	t.Cleanup(func() { DefaultQueryTimeout = old })
+
+	// users と posts の 2 回の INSERT は, それぞれは DefaultQueryTimeout 以内だが合わせると超える
+	slow := slowExecDB{ExtContext: db, delay: 150 * time.Millisecond}
+	if _, _, err := BulkInsert(context.Background(), slow, []User{{Name: "Alice"}}, []Post{{UserID: 1, Content: "Hello, Alice"}}); err != nil {
+		t.Fatalf("BulkInsert error = %v, want the timeout applied per query", err)
+	}
+}
+
+func TestSQLitePragmasOnEveryConnection(t *testing.T) {
+	db := newFileTestDB(t)
+	ctx := context.Background()
+
+	// 両方を持ったままにして, 別々の接続を開かせる
+	for i := range 2 {
+		conn, err := db.Connx(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+
+		var pragmas struct {
+			ForeignKeys int    `db:"foreign_keys"`
+			JournalMode string `db:"journal_mode"`
+			BusyTimeout int    `db:"busy_timeout"`
+		}
+		query := "SELECT (SELECT foreign_keys FROM pragma_foreign_keys) AS foreign_keys, " +
+			"(SELECT journal_mode FROM pragma_journal_mode) AS journal_mode, " +
+			"(SELECT timeout FROM pragma_busy_timeout) AS busy_timeout"
+		if err := conn.GetContext(ctx, &pragmas, query); err != nil {
+			t.Fatal(err)
+		}
+		if pragmas.ForeignKeys != 1 || pragmas.JournalMode != "wal" || pragmas.BusyTimeout != 5000 {
+			t.Errorf("connection %d: pragmas = %+v", i+1, pragmas)
+		}
+	}
+}
+
+func TestSQLiteDSN(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"./test.db", "./test.db?_foreign_keys=on&_journal_mode=WAL&_busy_timeout=5000"},
+		{"file::memory:?cache=shared", "file::memory:?cache=shared&_foreign_keys=on&_journal_mode=WAL&_busy_timeout=5000"},
+	}
+	for _, tt := range tests {
+		if got := SQLiteDSN(tt.path); got != tt.want {
+			t.Errorf("SQLiteDSN(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestSafeDBCloseTwice(t *testing.T) {
+	db := NewSafeDB(newTestDB(t))
+
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Errorf("second Close = %v, want the first result (nil)", err)
+	}
+	if err := db.Ping(); err == nil {
+		t.Error("DB is still open after Close")
+	}
+}
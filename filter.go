@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ゼロ値のフィールドは条件に含めない
+type UserFilter struct {
+	// 前方一致 (SearchUsersByName と同じく % と _ はエスケープされる)
+	NameLike string
+	IDs      []int
+	Limit    int
+	Offset   int
+}
+
+func ListUsers(ctx context.Context, db sqlx.ExtContext, f UserFilter) ([]User, error) {
+	q := NewUserQuery()
+	if f.NameLike != "" {
+		q.WhereNameLike(f.NameLike)
+	}
+	if len(f.IDs) > 0 {
+		q.WhereIDIn(f.IDs)
+	}
+	query, args, err := q.OrderBy("id", Asc).Limit(f.Limit).Offset(f.Offset).Build()
+	if err != nil {
+		return nil, fmt.Errorf("ListUsers.build: %w", err)
+	}
+
+	users := []User{}
+	if err := selectContext(ctx, db, &users, query, args...); err != nil {
+		return nil, fmt.Errorf("ListUsers.select: %w", err)
+	}
+	return users, nil
+}
+
+// 名前付きパラメータで絞り込めるカラム
+var userNamedFilterColumns = map[string]bool{
+	"id":   true,
+	"name": true,
+}
+
+// filter のキーをカラム名として, 全てに完全一致する users を返す
+// filter が空なら (論理削除されていない) 全件を返す
+// 例: SelectUsersNamed(ctx, db, map[string]any{"id": 1, "name": "Alice"})
+func SelectUsersNamed(ctx context.Context, db sqlx.ExtContext, filter map[string]any) ([]User, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	keys, err := allowedColumns(filter, userNamedFilterColumns)
+	if err != nil {
+		return nil, fmt.Errorf("SelectUsersNamed: %w", err)
+	}
+	where := []string{"deleted_at IS NULL"}
+	for _, k := range keys {
+		where = append(where, k+" = :"+k)
+	}
+	query := "SELECT " + userColumns + " FROM {users} WHERE " + strings.Join(where, " AND ") + " ORDER BY id"
+
+	// NamedQuery は :name を filter の値に置き換えて, ドライバのプレースホルダに書き換える
+	rows, err := namedQueryContext(ctx, db, query, filter)
+	if err != nil {
+		return nil, fmt.Errorf("SelectUsersNamed: %w", err)
+	}
+	defer rows.Close()
+
+	users := []User{}
+	for rows.Next() {
+		var u User
+		if err := rows.StructScan(&u); err != nil {
+			return nil, fmt.Errorf("SelectUsersNamed: %w", err)
+		}
+		users = append(users, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("SelectUsersNamed: %w", err)
+	}
+	return users, nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestListUsers(t *testing.T) {
+	db := newSeededTestDB(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		name   string
+		filter UserFilter
+		want   []string
+	}{
+		{"ids only", UserFilter{IDs: []int{1, 3}}, []string{"Alice", "Charlie"}},
+		{"name only", UserFilter{NameLike: "B"}, []string{"Bob"}},
+		{"both", UserFilter{NameLike: "A", IDs: []int{1, 2}}, []string{"Alice"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			users, err := ListUsers(ctx, db, tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := userNames(users); !slices.Equal(got, tt.want) {
+				t.Errorf("ListUsers(%+v) = %v, want %v", tt.filter, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectUsersNamed(t *testing.T) {
+	db := newSeededTestDB(t)
+	ctx := context.Background()
+
+	users, err := SelectUsersNamed(ctx, db, map[string]any{"id": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := userNames(users), []string{"Alice"}; !slices.Equal(got, want) {
+		t.Errorf("SelectUsersNamed = %v, want %v", got, want)
+	}
+
+	if _, err := SelectUsersNamed(ctx, db, map[string]any{"id = 1 OR 1": 1}); err == nil {
+		t.Error("SelectUsersNamed accepted an unknown column")
+	}
+}
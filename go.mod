@@ -5,9 +5,7 @@ go 1.23.0
 require (
 	github.com/jmoiron/sqlx v1.4.0
 	github.com/mattn/go-sqlite3 v1.14.23
+	github.com/samber/lo v1.47.0
 )
 
-require (
-	github.com/samber/lo v1.47.0 // indirect
-	golang.org/x/text v0.16.0 // indirect
-)
+require golang.org/x/text v0.16.0 // indirect
@@ -0,0 +1,60 @@
+package main
+
+import "github.com/samber/lo"
+
+// JOIN した結果などを user_id ごとにまとめる
+// 空の入力には空の map を返す
+func GroupByUserID[T any](rows []T, key func(T) int) map[int][]T {
+	return lo.GroupBy(rows, key)
+}
+
+type UserWithPosts struct {
+	User  User   `json:"user"`
+	Posts []Post `json:"posts"`
+}
+
+// 親 1 件に子が複数ぶら下がったもの
+type OneToMany[P, C any] struct {
+	Parent   P
+	Children []C
+}
+
+// JOIN した 1 行 1 子の結果を親ごとの入れ子の構造に畳む
+// 親は key が同じ行の最初の 1 行から parent で作り, 子は各行から child で作る
+// child が false を返す行 (LEFT JOIN で子がない行) は子に含めない
+// 親の順序は最初に現れた順を保ち, 子がない親は空のスライスを持つ
+func ScanOneToMany[R any, K comparable, P, C any](rows []R, key func(R) K, parent func(R) P, child func(R) (C, bool)) []OneToMany[P, C] {
+	result := []OneToMany[P, C]{}
+	index := map[K]int{}
+	for _, r := range rows {
+		k := key(r)
+		i, ok := index[k]
+		if !ok {
+			i = len(result)
+			index[k] = i
+			result = append(result, OneToMany[P, C]{Parent: parent(r), Children: []C{}})
+		}
+		if c, ok := child(r); ok {
+			result[i].Children = append(result[i].Children, c)
+		}
+	}
+	return result
+}
+
+// LEFT JOIN の 1 行 1 post の結果を user ごとの入れ子の構造に畳む
+// user の順序は最初に現れた順を保ち, posts がない user は空のスライスを持つ
+func PreloadPosts(rows []UserWithOptionalPost) []UserWithPosts {
+	grouped := ScanOneToMany(rows,
+		func(r UserWithOptionalPost) int { return r.User.ID },
+		func(r UserWithOptionalPost) User { return r.User },
+		func(r UserWithOptionalPost) (Post, bool) {
+			if r.Post == nil {
+				return Post{}, false
+			}
+			return *r.Post, true
+		},
+	)
+	return lo.Map(grouped, func(g OneToMany[User, Post], _ int) UserWithPosts {
+		return UserWithPosts{User: g.Parent, Posts: g.Children}
+	})
+}
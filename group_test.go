@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"maps"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func TestGroupByUserID(t *testing.T) {
+	tests := []struct {
+		name  string
+		posts []Post
+		want  map[int][]int
+	}{
+		{"empty", nil, map[int][]int{}},
+		{"single group", []Post{{ID: 1, UserID: 1}, {ID: 2, UserID: 1}}, map[int][]int{1: {1, 2}}},
+		{"multiple groups", []Post{{ID: 1, UserID: 1}, {ID: 2, UserID: 2}, {ID: 3, UserID: 1}}, map[int][]int{1: {1, 3}, 2: {2}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			grouped := GroupByUserID(tt.posts, func(p Post) int { return p.UserID })
+			if grouped == nil {
+				t.Fatal("GroupByUserID returned a nil map")
+			}
+			got := map[int][]int{}
+			for userID, posts := range grouped {
+				for _, p := range posts {
+					got[userID] = append(got[userID], p.ID)
+				}
+			}
+			if !maps.EqualFunc(got, tt.want, slices.Equal) {
+				t.Errorf("GroupByUserID = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPreloadPosts(t *testing.T) {
+	db := newSeededTestDB(t)
+
+	users, err := SelectUsersWithPosts(context.Background(), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]int{}
+	for _, u := range users {
+		if u.Posts == nil {
+			t.Errorf("%s has nil Posts", u.User.Name)
+		}
+		got[u.User.Name] = len(u.Posts)
+	}
+	if want := map[string]int{"Alice": 2, "Bob": 1, "Charlie": 0}; !maps.Equal(got, want) {
+		t.Errorf("post counts = %v, want %v", got, want)
+	}
+}
+
+// user_id ごとの post の id
+func userPostIDs(ups []UserPosts) map[int][]int {
+	ids := map[int][]int{}
+	for _, up := range ups {
+		ids[up.UserID] = []int{}
+		for _, p := range up.Posts {
+			ids[up.UserID] = append(ids[up.UserID], p.ID)
+		}
+	}
+	return ids
+}
+
+func TestSelectUserPosts(t *testing.T) {
+	db := newSeededTestDB(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		selectFn func(context.Context, sqlx.ExtContext) ([]UserPosts, error)
+		want     map[int][]int
+	}{
+		{"dense", SelectUserPosts, map[int][]int{1: {1, 2}, 2: {3}, 3: {}}},
+		// posts がない user は含まない
+		{"sparse", SelectUserPostsSparse, map[int][]int{1: {1, 2}, 2: {3}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ups, err := tt.selectFn(ctx, db)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := userPostIDs(ups); !maps.EqualFunc(got, tt.want, slices.Equal) {
+				t.Errorf("post ids = %v, want %v", got, tt.want)
+			}
+			if !slices.IsSortedFunc(ups, func(a, b UserPosts) int { return a.UserID - b.UserID }) {
+				t.Errorf("result is not sorted by user_id: %v", ups)
+			}
+		})
+	}
+}
+
+func TestScanOneToMany(t *testing.T) {
+	// LEFT JOIN の 1 行. PostID が 0 なら posts がない
+	type row struct {
+		UserID int
+		PostID int
+	}
+	tests := []struct {
+		name string
+		rows []row
+		want []OneToMany[int, int]
+	}{
+		{"empty", nil, []OneToMany[int, int]{}},
+		{
+			"users with posts",
+			[]row{{1, 1}, {1, 2}, {2, 3}},
+			[]OneToMany[int, int]{{Parent: 1, Children: []int{1, 2}}, {Parent: 2, Children: []int{3}}},
+		},
+		{
+			"user without posts",
+			[]row{{1, 1}, {3, 0}, {2, 2}},
+			[]OneToMany[int, int]{{Parent: 1, Children: []int{1}}, {Parent: 3, Children: []int{}}, {Parent: 2, Children: []int{2}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ScanOneToMany(tt.rows,
+				func(r row) int { return r.UserID },
+				func(r row) int { return r.UserID },
+				func(r row) (int, bool) { return r.PostID, r.PostID != 0 },
+			)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ScanOneToMany = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
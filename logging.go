@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// 実行した SQL を slog の Debug で出力する
+// sqlx.ExtContext を満たすので, *sqlx.DB や *sqlx.Tx の代わりにそのまま各関数に渡せる
+type LoggingDB struct {
+	sqlx.ExtContext
+	Logger *slog.Logger
+}
+
+var _ sqlx.ExtContext = (*LoggingDB)(nil)
+
+// logger が nil なら slog.Default() を使う
+func NewLoggingDB(db sqlx.ExtContext, logger *slog.Logger) *LoggingDB {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &LoggingDB{ExtContext: db, Logger: logger}
+}
+
+func (l *LoggingDB) log(ctx context.Context, query string, args []any, start time.Time, err error, attrs ...slog.Attr) {
+	attrs = append([]slog.Attr{
+		slog.String("query", query),
+		slog.Any("args", args),
+		slog.Duration("duration", time.Since(start)),
+	}, attrs...)
+	if err != nil {
+		attrs = append(attrs, slog.Any("error", err))
+	}
+	l.Logger.LogAttrs(ctx, slog.LevelDebug, "sql", attrs...)
+}
+
+func (l *LoggingDB) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	start := time.Now()
+	rows, err := l.ExtContext.QueryContext(ctx, query, args...)
+	l.log(ctx, query, args, start, err)
+	return rows, err
+}
+
+// SELECT の件数は rows を読み切るまで分からないので出力しない
+func (l *LoggingDB) QueryxContext(ctx context.Context, query string, args ...any) (*sqlx.Rows, error) {
+	start := time.Now()
+	rows, err := l.ExtContext.QueryxContext(ctx, query, args...)
+	l.log(ctx, query, args, start, err)
+	return rows, err
+}
+
+// エラーは Scan するまで分からないので, ここでは時間だけ出力する
+func (l *LoggingDB) QueryRowxContext(ctx context.Context, query string, args ...any) *sqlx.Row {
+	start := time.Now()
+	row := l.ExtContext.QueryRowxContext(ctx, query, args...)
+	l.log(ctx, query, args, start, nil)
+	return row
+}
+
+func (l *LoggingDB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	start := time.Now()
+	result, err := l.ExtContext.ExecContext(ctx, query, args...)
+	if err != nil {
+		l.log(ctx, query, args, start, err)
+		return result, err
+	}
+	rowsAffected, _ := result.RowsAffected()
+	l.log(ctx, query, args, start, nil, slog.Int64("rows", rowsAffected))
+	return result, err
+}
+
+// NewSlowQueryDB でこれ以上かかったクエリだけを出力する
+// 0 にすると全てのクエリを出力する. クエリの実行中に書き換えないこと
+var SlowQueryThreshold = 100 * time.Millisecond
+
+// LoggingDB は全てのクエリを出力するので, 遅いクエリだけを slog の Warn で出力したいときに使う
+// logger が nil なら slog.Default() を使う
+func NewSlowQueryDB(db sqlx.ExtContext, logger *slog.Logger) *ObservedDB {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return NewObservedDB(db, func(query string, dur time.Duration, err error) {
+		if dur < SlowQueryThreshold {
+			return
+		}
+		attrs := []slog.Attr{
+			slog.String("query", query),
+			slog.Duration("duration", dur),
+		}
+		if err != nil {
+			attrs = append(attrs, slog.Any("error", err))
+		}
+		logger.LogAttrs(context.Background(), slog.LevelWarn, "slow sql", attrs...)
+	})
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 出力されたレコードを溜めておく slog.Handler
+type recordingHandler struct {
+	mu      sync.Mutex
+	records []slog.Record
+}
+
+func (h *recordingHandler) Enabled(context.Context, slog.Level) bool { return true }
+
+func (h *recordingHandler) Handle(_ context.Context, r slog.Record) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.records = append(h.records, r)
+	return nil
+}
+
+func (h *recordingHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+func (h *recordingHandler) WithGroup(string) slog.Handler      { return h }
+
+func (h *recordingHandler) Records() []slog.Record {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]slog.Record(nil), h.records...)
+}
+
+func recordAttrs(r slog.Record) map[string]slog.Value {
+	attrs := map[string]slog.Value{}
+	r.Attrs(func(a slog.Attr) bool {
+		attrs[a.Key] = a.Value
+		return true
+	})
+	return attrs
+}
+
+func TestLoggingDB(t *testing.T) {
+	h := &recordingHandler{}
+	db := NewLoggingDB(newSeededTestDB(t), slog.New(h))
+
+	if _, err := SelectUsers(context.Background(), db); err != nil {
+		t.Fatal(err)
+	}
+	records := h.Records()
+	if len(records) != 1 {
+		t.Fatalf("logged %d records, want 1", len(records))
+	}
+	attrs := recordAttrs(records[0])
+	if attrs["query"].String() == "" {
+		t.Error("query is not logged")
+	}
+	if d := attrs["duration"].Duration(); d <= 0 {
+		t.Errorf("duration = %v, want > 0", d)
+	}
+}
+
+func TestSlowQueryThreshold(t *testing.T) {
+	old := SlowQueryThreshold
+	t.Cleanup(func() { SlowQueryThreshold = old })
+
+	tests := []struct {
+		threshold time.Duration
+		want      int
+	}{
+		{0, 1},
+		{time.Hour, 0},
+	}
+	for _, tt := range tests {
+		SlowQueryThreshold = tt.threshold
+		h := &recordingHandler{}
+		db := NewSlowQueryDB(newSeededTestDB(t), slog.New(h))
+		if _, err := SelectUsers(context.Background(), db); err != nil {
+			t.Fatal(err)
+		}
+		if got := len(h.Records()); got != tt.want {
+			t.Errorf("threshold %v: logged %d records, want %d", tt.threshold, got, tt.want)
+		}
+	}
+}
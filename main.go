@@ -1,130 +1,1047 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
 
 	"github.com/jmoiron/sqlx"
-	_ "github.com/mattn/go-sqlite3"
 	"github.com/samber/lo"
 )
 
-// camel case でないならタグは不要
+var (
+	ErrUserNotFound = errors.New("user not found")
+	ErrInvalidUser  = errors.New("invalid user")
+)
+
+// 文字数 (バイト数ではない)
+const MaxUserNameLength = 64
+
+// InitDB で snake_case の mapper を設定しているので db タグは省略できる
+// ただし LoggingDB などを NamedExec に渡すと sqlx のデフォルト (小文字にするだけ) になるので, 複数単語のフィールドはタグを残す
 type User struct {
-	ID   int
-	Name string
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+	// 論理削除されていなければ nil
+	DeletedAt *time.Time `db:"deleted_at" json:"deleted_at,omitempty"`
+}
+
+// DB の NOT NULL は空文字を弾かないので, 挿入前にこちらで確認する
+func (u User) Validate() error {
+	if strings.TrimSpace(u.Name) == "" {
+		return fmt.Errorf("%w: name is empty", ErrInvalidUser)
+	}
+	if n := utf8.RuneCountInString(u.Name); n > MaxUserNameLength {
+		return fmt.Errorf("%w: name is too long (%d > %d)", ErrInvalidUser, n, MaxUserNameLength)
+	}
+	return nil
 }
 
 type Post struct {
-	ID      int
-	UserID  int `db:"user_id"`
-	Content string
+	ID      int    `json:"id"`
+	UserID  int    `db:"user_id" json:"user_id"`
+	Content string `json:"content"`
+	// 空ならカラムの DEFAULT の draft になる. BulkInsert だけは published にする
+	Status PostStatus `json:"status"`
+	// posts.metadata に JSON として保存される. NULL なら nil
+	Metadata  PostMetadata `json:"metadata"`
+	CreatedAt time.Time    `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time    `db:"updated_at" json:"updated_at"`
 }
 
 func main() {
-	db := InitDB()
-	defer db.Close()
+	if err := Run(context.Background()); err != nil {
+		log.Fatalln(err)
+	}
+}
 
-	BulkInsert(db)
-	SelectUsers(db)
-	InQuery(db)
-	JoinQuery(db)
-	SelectUserPosts(db)
+// Run が使う DB を開く. テストでは一時ファイルの DB に差し替える
+var openDB = func() (*sqlx.DB, error) {
+	return InitDB("sqlite3", "./test.db")
 }
 
-func InitDB() *sqlx.DB {
-	db, err := sqlx.Connect("sqlite3", "./test.db")
+// DB の接続から切断までを受け持つ
+// デモを実行した後は ctx がキャンセルされるか SIGINT/SIGTERM を受けるまで待ち, それから DB を閉じる
+func Run(ctx context.Context) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	conn, err := openDB()
 	if err != nil {
-		log.Fatalln(err)
+		return err
 	}
+	db := NewSafeDB(conn)
+	// Close は実行中のクエリが終わるまで待つ
+	defer db.Close()
+	ConfigurePool(db.DB, PoolConfig{})
 	log.Println("Connected to the database")
 
-	// テーブルの作成
-	schema := `
-		DROP TABLE IF EXISTS users;
-		CREATE TABLE users (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			name TEXT NOT NULL
-		);
-
-		DROP TABLE IF EXISTS posts;
-		CREATE TABLE posts (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			user_id INTEGER NOT NULL,
-			content TEXT NOT NULL,
-			FOREIGN KEY (user_id) REFERENCES users(id)
-		);
-	`
+	if err := runDemo(ctx, db.DB); err != nil {
+		return err
+	}
 
-	_, err = db.Exec(schema)
-	if err != nil {
-		log.Fatalln(err)
+	log.Println("Waiting for a signal to shut down")
+	<-ctx.Done()
+	log.Println("Shutting down")
+	return nil
+}
+
+func runDemo(ctx context.Context, db *sqlx.DB) error {
+	// デモなので毎回まっさらな状態から始める
+	if err := ResetSchema(ctx, db); err != nil {
+		return err
+	}
+	if err := Migrate(ctx, db, SchemaMigrations(DialectFor(db.DriverName()))); err != nil {
+		return err
 	}
 	log.Println("Created tables")
 
+	if err := Seed(ctx, db); err != nil {
+		return err
+	}
+	log.Println("Seeded demo data")
+
+	// 存在しない user_id を参照する post は弾かれ, users もロールバックされる
+	err := BulkInsertTx(ctx, db, []User{{Name: "Dave"}}, []Post{{UserID: 999, Content: "Hello, nobody"}})
+	// FOREIGN KEY constraint failed
+	log.Println("Insert orphan post:", err)
+
+	users, err := SelectUsers(ctx, db)
+	if err != nil {
+		return err
+	}
+	// [{1 Alice <created_at> <updated_at> <nil>} {2 Bob ...} {3 Charlie ...}]
+	log.Println("All users:", users)
+
+	user, err := GetUserByID(ctx, db, 1)
+	if err != nil {
+		return err
+	}
+	// {1 Alice <created_at> <updated_at> <nil>}
+	log.Println("User:", user)
+	if _, err := GetUserByID(ctx, db, 999); errors.Is(err, ErrUserNotFound) {
+		log.Println("User 999:", err)
+	}
+
+	users, err = InQuery(ctx, db, []int{1, 2})
+	if err != nil {
+		return err
+	}
+	// [{1 Alice ...} {2 Bob ...}]
+	log.Println("Selected users:", users)
+
+	joined, err := JoinQuery(ctx, db)
+	if err != nil {
+		return err
+	}
+	// [{{1 Alice ...} {1 1 Hello, Alice ...}} {{1 Alice ...} {2 1 Nice to meet you ...}} {{2 Bob ...} {3 2 Hello, Bob ...}}]
+	log.Println("Joined result:", joined)
+
+	userPosts, err := SelectUserPosts(ctx, db)
+	if err != nil {
+		return err
+	}
+	// [{1 [{1 1 Hello, Alice ...} {2 1 Nice to meet you ...}]} {2 [{3 2 Hello, Bob ...}]} {3 []}]
+	log.Println("User posts:", userPosts)
+
+	userPosts, err = SelectUserPostsSparse(ctx, db)
+	if err != nil {
+		return err
+	}
+	// [{1 [{1 1 Hello, Alice ...} {2 1 Nice to meet you ...}]} {2 [{3 2 Hello, Bob ...}]}]
+	log.Println("User posts:", userPosts)
+
+	// 外部キー制約違反の 1 件がエラーとして数えられる
+	log.Printf("Metrics: %+v\n", Metrics())
+	return nil
+}
+
+// ":memory:" を使う場合は接続ごとに別の DB になるので注意
+// (SetMaxOpenConns(1) にするか "file::memory:?cache=shared" を使う)
+//
+// sqlite3 のときは接続を開くたびに sqlitePragmas を実行するので, DSN に PRAGMA を指定しなくていい
+func InitDB(driver, dsn string) (*sqlx.DB, error) {
+	var db *sqlx.DB
+	var err error
+	if driver == "sqlite3" {
+		db, err = connectSQLite(dsn)
+	} else {
+		// Connect は Ping まで行う
+		db, err = sqlx.Connect(driver, dsn)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("InitDB: %w", err)
+	}
+	// デフォルトはフィールド名を小文字にするだけなので, UserID が userid になってしまう
+	db.MapperFunc(toSnakeCase)
+	return db, nil
+}
+
+// 接続できなければ panic する
+// エラーを処理しようがない main や初期化処理から使う
+func MustInitDB(driver, dsn string) *sqlx.DB {
+	db, err := InitDB(driver, dsn)
+	if err != nil {
+		panic(err)
+	}
 	return db
 }
 
-func BulkInsert(db *sqlx.DB) {
-	users := []User{
-		{Name: "Alice"},
-		{Name: "Bob"},
-		{Name: "Charlie"},
+// SELECT * だと, テーブルにあって構造体にないカラムがあると Scan がエラーになる
+// 構造体のタグからカラムを並べておけば, 先にカラムだけ追加しても壊れない
+var (
+	userColumns = strings.Join(Columns[User](), ", ")
+	postColumns = strings.Join(Columns[Post](), ", ")
+)
+
+// カラムは構造体のタグから作るので, フィールドを足せば INSERT にも入る
+// id は自動採番, deleted_at は論理削除のときだけ入れるので除く
+var (
+	userInsertColumns = lo.Without(Columns[User](), "id", "deleted_at")
+	postInsertColumns = lo.Without(Columns[Post](), "id")
+	insertUsersQuery  = buildInsertQuery("{users}", userInsertColumns)
+	// status を指定しなければ NULL が渡るので, カラムの DEFAULT と同じ draft で埋める
+	// SQLite は VALUES に DEFAULT と書けないので, 式にしておく
+	insertPostsQuery = strings.Replace(buildInsertQuery("{posts}", postInsertColumns), ":status", "COALESCE(:status, 'draft')", 1)
+)
+
+// users は name が, posts は user_id と content の組が既にあれば挿入しない
+// どちらも UNIQUE 制約があるので, SQLite と Postgres の両方で使える ON CONFLICT DO NOTHING で済む
+var (
+	insertUsersIgnoreQuery = insertUsersQuery + " ON CONFLICT(name) DO NOTHING"
+	insertPostsIgnoreQuery = insertPostsQuery + " ON CONFLICT(user_id, content) DO NOTHING"
+)
+
+// users, posts の順に挿入し, それぞれの件数を返す
+// 呼び出し元のスライスは書き換えない. 空のスライスは DB に触らずに 0 件とする
+func BulkInsert(ctx context.Context, db sqlx.ExtContext, users []User, posts []Post) (int64, int64, error) {
+	return bulkInsert(ctx, db, "BulkInsert", users, posts, false)
+}
+
+// Migrate せずに何度実行しても重複もエラーも起きない BulkInsert
+// 返す件数は実際に挿入した件数なので, 2 回目以降は 0 になる
+func BulkInsertIgnoreExisting(ctx context.Context, db sqlx.ExtContext, users []User, posts []Post) (int64, int64, error) {
+	return bulkInsert(ctx, db, "BulkInsertIgnoreExisting", users, posts, true)
+}
+
+func bulkInsert(ctx context.Context, db sqlx.ExtContext, op string, users []User, posts []Post, ignoreExisting bool) (int64, int64, error) {
+	now := time.Now()
+	users = lo.Map(users, func(u User, _ int) User {
+		u.CreatedAt, u.UpdatedAt = now, now
+		return u
+	})
+	posts = lo.Map(posts, func(p Post, _ int) Post {
+		if p.Status == "" {
+			p.Status = PostStatusPublished
+		}
+		p.CreatedAt, p.UpdatedAt = now, now
+		return p
+	})
+
+	for _, u := range users {
+		if err := u.Validate(); err != nil {
+			return 0, 0, fmt.Errorf("%s.users: %w", op, err)
+		}
+	}
+	usersQuery, postsQuery := insertUsersQuery, insertPostsQuery
+	if ignoreExisting {
+		usersQuery, postsQuery = insertUsersIgnoreQuery, insertPostsIgnoreQuery
 	}
-	result, err := db.NamedExec("INSERT INTO users (name) VALUES (:name)", users)
+	// NamedExec に空のスライスを渡すと VALUES が組み立てられずにエラーになるので, 空なら DB に触らずに 0 件とする
+	var result sql.Result
+	var err error
+	var usersInserted int64
+	if len(users) > 0 {
+		err = withRetry(defaultRetryAttempts, func() (err error) {
+			result, err = namedExecContext(ctx, db, usersQuery, users)
+			return err
+		})
+		if err != nil {
+			return 0, 0, fmt.Errorf("%s.users: %w", op, asConflictError(err))
+		}
+		usersInserted, err = result.RowsAffected()
+		if err != nil {
+			return 0, 0, fmt.Errorf("%s.users: %w", op, err)
+		}
+	}
+
+	if len(posts) == 0 {
+		return usersInserted, 0, nil
+	}
+	err = withRetry(defaultRetryAttempts, func() (err error) {
+		result, err = namedExecContext(ctx, db, postsQuery, posts)
+		return err
+	})
 	if err != nil {
-		log.Fatalln(err)
+		return 0, 0, fmt.Errorf("%s.posts: %w", op, err)
+	}
+	postsInserted, err := result.RowsAffected()
+	if err != nil {
+		return 0, 0, fmt.Errorf("%s.posts: %w", op, err)
+	}
+	return usersInserted, postsInserted, nil
+}
+
+// NamedExec を使わずに INSERT INTO users (...) VALUES (?, ?, ?), (?, ?, ?), ... を組み立てて挿入する
+// バインド変数の数が inQueryChunkSize を超えないように, 行数で区切って複数回に分ける
+// 分けた場合は途中で失敗しても前の分は残るので, まとめて戻したいときは tx を渡す
+func BulkInsertMultiValues(ctx context.Context, db sqlx.ExtContext, users []User) (int64, error) {
+	for _, u := range users {
+		if err := u.Validate(); err != nil {
+			return 0, fmt.Errorf("BulkInsertMultiValues: %w", err)
+		}
+	}
+
+	now := time.Now()
+	columns := []string{"name", "created_at", "updated_at"}
+	tuple := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ") + ")"
+
+	var total int64
+	for _, chunk := range lo.Chunk(users, inQueryChunkSize/len(columns)) {
+		args := make([]any, 0, len(chunk)*len(columns))
+		for _, u := range chunk {
+			args = append(args, u.Name, now, now)
+		}
+		query := "INSERT INTO {users} (" + strings.Join(columns, ", ") + ") VALUES " +
+			strings.TrimSuffix(strings.Repeat(tuple+", ", len(chunk)), ", ")
+		result, err := execContext(ctx, db, query, args...)
+		if err != nil {
+			return 0, fmt.Errorf("BulkInsertMultiValues: %w", asConflictError(err))
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return 0, fmt.Errorf("BulkInsertMultiValues: %w", err)
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// users, posts をまとめて挿入し, どちらかが失敗したら両方ロールバックする
+func BulkInsertTx(ctx context.Context, db *sqlx.DB, users []User, posts []Post) error {
+	return BulkInsertTxOpts(ctx, db, nil, users, posts)
+}
+
+// BulkInsertTx でトランザクションの分離レベルを指定する
+// 挿入は BulkInsert に tx を渡して行うので, 既定値の埋め方やリトライは BulkInsert と同じになる
+func BulkInsertTxOpts(ctx context.Context, db *sqlx.DB, opts *sql.TxOptions, users []User, posts []Post) error {
+	err := WithTxOpts(ctx, db, opts, func(tx *sqlx.Tx) error {
+		_, _, err := BulkInsert(ctx, tx, users, posts)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("BulkInsertTx: %w", err)
+	}
+	return nil
+}
+
+// 1 件ずつ挿入して, 失敗した行があっても残りは続ける
+// 返り値はどちらも users と同じ長さで, i 番目の user が挿入できれば users[i] に採番された ID が入り errs[i] は nil になる
+//
+// inTx が true なら全体を 1 つのトランザクションで行い, 最後に成功した行だけをまとめて Commit する
+// Postgres は 1 つでも失敗するとトランザクション全体が使えなくなるので, 行ごとに SAVEPOINT を切って失敗した行だけ戻す
+func BulkInsertUsersCollect(ctx context.Context, db *sqlx.DB, users []User, inTx bool) ([]User, []error) {
+	now := time.Now()
+	inserted := lo.Map(users, func(u User, _ int) User {
+		u.CreatedAt, u.UpdatedAt = now, now
+		return u
+	})
+	errs := make([]error, len(users))
+
+	insert := func(ctx context.Context, q sqlx.ExtContext, i int) error {
+		u := inserted[i]
+		if err := u.Validate(); err != nil {
+			return err
+		}
+		query, args, err := q.BindNamed(insertUsersQuery+" RETURNING id", u)
+		if err != nil {
+			return err
+		}
+		if err := getContext(ctx, q, &inserted[i].ID, query, args...); err != nil {
+			return asConflictError(err)
+		}
+		return nil
+	}
+
+	if !inTx {
+		for i := range inserted {
+			if err := insert(ctx, db, i); err != nil {
+				errs[i] = fmt.Errorf("BulkInsertUsersCollect[%d]: %w", i, err)
+			}
+		}
+		return inserted, errs
+	}
+
+	err := WithTx(ctx, db, func(tx *sqlx.Tx) error {
+		for i := range inserted {
+			if _, err := execContext(ctx, tx, "SAVEPOINT bulk_insert_users"); err != nil {
+				return err
+			}
+			if err := insert(ctx, tx, i); err != nil {
+				errs[i] = fmt.Errorf("BulkInsertUsersCollect[%d]: %w", i, err)
+				if _, err := execContext(ctx, tx, "ROLLBACK TO SAVEPOINT bulk_insert_users"); err != nil {
+					return err
+				}
+				continue
+			}
+			if _, err := execContext(ctx, tx, "RELEASE SAVEPOINT bulk_insert_users"); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		// Commit できなければ 1 件も入っていないので, 成功したはずの行もエラーにする
+		for i := range inserted {
+			if errs[i] == nil {
+				inserted[i].ID = 0
+				errs[i] = fmt.Errorf("BulkInsertUsersCollect[%d]: %w", i, err)
+			}
+		}
+	}
+	return inserted, errs
+}
+
+// user が存在しなければ ErrUserNotFound を返し, post は作らない
+// 確認と挿入の間に user が消されないよう同じトランザクションで行う
+func InsertPostsForUser(ctx context.Context, db *sqlx.DB, userID int, contents []string) error {
+	return WithTx(ctx, db, func(tx *sqlx.Tx) error {
+		return insertPostsForUserTx(ctx, tx, userID, contents)
+	})
+}
+
+// InsertPostsForUser のうちトランザクションの中で行う部分
+func insertPostsForUserTx(ctx context.Context, tx *sqlx.Tx, userID int, contents []string) error {
+	now := time.Now()
+	posts := lo.Map(contents, func(c string, _ int) Post {
+		return Post{UserID: userID, Content: c, CreatedAt: now, UpdatedAt: now}
+	})
+
+	exists, err := UserExists(ctx, tx, userID)
+	if err != nil {
+		return fmt.Errorf("InsertPostsForUser: %w", err)
+	}
+	if !exists {
+		return fmt.Errorf("InsertPostsForUser: %w", ErrUserNotFound)
+	}
+	// 空のスライスを NamedExec に渡すとエラーになる
+	if len(posts) == 0 {
+		return nil
+	}
+	if _, err := namedExecContext(ctx, tx, insertPostsQuery, posts); err != nil {
+		return fmt.Errorf("InsertPostsForUser: %w", err)
+	}
+	return nil
+}
+
+// user の posts を渡したものだけにする (既存の posts は全部消す)
+// posts の UserID は無視して userID で上書きする
+func ReplaceUserPosts(ctx context.Context, db *sqlx.DB, userID int, posts []Post) error {
+	now := time.Now()
+	posts = lo.Map(posts, func(p Post, _ int) Post {
+		p.UserID = userID
+		p.CreatedAt, p.UpdatedAt = now, now
+		return p
+	})
+
+	return WithTx(ctx, db, func(tx *sqlx.Tx) error {
+		if _, err := execContext(ctx, tx, "DELETE FROM {posts} WHERE user_id = ?", userID); err != nil {
+			return fmt.Errorf("ReplaceUserPosts.delete: %w", err)
+		}
+		if len(posts) == 0 {
+			return nil
+		}
+		if _, err := namedExecContext(ctx, tx, insertPostsQuery, posts); err != nil {
+			return fmt.Errorf("ReplaceUserPosts.insert: %w", err)
+		}
+		return nil
+	})
+}
+
+// NamedExec にスライスを渡すと VALUES (...), (...) に展開されるだけなので UPDATE には使えない
+// 代わりに 1 回 prepare した文をトランザクション内でループして実行する
+func BulkUpdatePosts(ctx context.Context, db *sqlx.DB, posts []Post) (int64, error) {
+	var total int64
+	err := WithTx(ctx, db, func(tx *sqlx.Tx) error {
+		stmt, err := tx.PrepareNamedContext(ctx, expandTables("UPDATE {posts} SET content = :content, updated_at = :updated_at WHERE id = :id"))
+		if err != nil {
+			return fmt.Errorf("BulkUpdatePosts.prepare: %w", err)
+		}
+		defer stmt.Close()
+
+		now := time.Now()
+		for _, p := range posts {
+			p.UpdatedAt = now
+			// stmt はヘルパーを通らないので, ここで 1 行ごとに掛ける
+			qctx, cancel := withTimeout(ctx)
+			result, err := stmt.ExecContext(qctx, p)
+			cancel()
+			recordQuery(err)
+			if err != nil {
+				return fmt.Errorf("BulkUpdatePosts.update: %w", err)
+			}
+			rowsAffected, err := result.RowsAffected()
+			if err != nil {
+				return fmt.Errorf("BulkUpdatePosts.update: %w", err)
+			}
+			total += rowsAffected
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return total, nil
+}
+
+// 論理削除された user は含まない
+func SelectUsers(ctx context.Context, db sqlx.ExtContext) ([]User, error) {
+	users, err := SelectAll[User](ctx, db, "SELECT "+userColumns+" FROM {users} WHERE deleted_at IS NULL")
+	if err != nil {
+		return nil, fmt.Errorf("SelectUsers: %w", err)
+	}
+	return users, nil
+}
+
+func SelectUsersIncludingDeleted(ctx context.Context, db sqlx.ExtContext) ([]User, error) {
+	users, err := SelectAll[User](ctx, db, "SELECT "+userColumns+" FROM {users}")
+	if err != nil {
+		return nil, fmt.Errorf("SelectUsersIncludingDeleted: %w", err)
+	}
+	return users, nil
+}
+
+// users.name が NULL の行 (スキーマの変更や LEFT JOIN で起こりうる) があっても Scan に失敗しないように sql.Null で受ける
+// string にそのまま NULL を Scan するとエラーになって, 全件の取得が失敗する
+type nullableUserRow struct {
+	ID        int              `db:"id"`
+	Name      sql.Null[string] `db:"name"`
+	CreatedAt time.Time        `db:"created_at"`
+	UpdatedAt time.Time        `db:"updated_at"`
+	DeletedAt *time.Time       `db:"deleted_at"`
+}
+
+func (r nullableUserRow) toUser() LenientUser {
+	return LenientUser{
+		User: User{
+			ID:        r.ID,
+			Name:      NullToZero(r.Name),
+			CreatedAt: r.CreatedAt,
+			UpdatedAt: r.UpdatedAt,
+			DeletedAt: r.DeletedAt,
+		},
+		NameIsNull: !r.Name.Valid,
+	}
+}
+
+// name が NULL なら Name は "" で NameIsNull が true になる
+type LenientUser struct {
+	User
+	NameIsNull bool `json:"-"`
+}
+
+// SelectUsers と同じ users を, name が NULL の行があっても失敗せずに返す
+func SelectUsersLenient(ctx context.Context, db sqlx.ExtContext) ([]LenientUser, error) {
+	rows, err := SelectAll[nullableUserRow](ctx, db, "SELECT "+userColumns+" FROM {users} WHERE deleted_at IS NULL ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("SelectUsersLenient: %w", err)
+	}
+	return lo.Map(rows, func(r nullableUserRow, _ int) LenientUser {
+		return r.toUser()
+	}), nil
+}
+
+// 全件をスライスに載せずに 1 行ずつ fn に渡す
+// fn がエラーを返すとそこで止めて, そのエラーを返す
+// 大きなテーブル向けなので DefaultQueryTimeout は掛けない (fn の処理時間まで含まれてしまう)
+// 全体の上限は呼び出し元が ctx で決める
+func StreamUsers(ctx context.Context, db sqlx.QueryerContext, fn func(User) error) error {
+	rows, err := queryxContext(ctx, db, "SELECT "+userColumns+" FROM {users} WHERE deleted_at IS NULL ORDER BY id")
+	if err != nil {
+		return fmt.Errorf("StreamUsers: %w", err)
+	}
+	// 途中で return しても接続がプールに戻るように必ず閉じる
+	defer rows.Close()
+
+	for rows.Next() {
+		var u User
+		if err := rows.StructScan(&u); err != nil {
+			return fmt.Errorf("StreamUsers: %w", err)
+		}
+		if err := fn(u); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("StreamUsers: %w", err)
+	}
+	return nil
+}
+
+// id から user を引けるようにする. 論理削除された user は含まない
+// SelectUserPostsSparse のように user の情報が落ちた結果を補うのに使う
+func SelectUsersMap(ctx context.Context, db sqlx.ExtContext) (map[int]User, error) {
+	users, err := SelectUsers(ctx, db)
+	if err != nil {
+		return nil, fmt.Errorf("SelectUsersMap: %w", err)
+	}
+	return lo.KeyBy(users, func(u User) int {
+		return u.ID
+	}), nil
+}
+
+// HTTP のレスポンスにそのまま書ける形で返す
+func UsersJSON(ctx context.Context, db sqlx.ExtContext) ([]byte, error) {
+	users, err := SelectUsers(ctx, db)
+	if err != nil {
+		return nil, fmt.Errorf("UsersJSON: %w", err)
+	}
+	b, err := json.Marshal(users)
+	if err != nil {
+		return nil, fmt.Errorf("UsersJSON: %w", err)
+	}
+	return b, nil
+}
+
+// ORDER BY にはプレースホルダが使えないので, 許可したカラム名だけ埋め込む
+var userOrderColumns = []string{"id", "name"}
+
+func SelectUsersOrdered(ctx context.Context, db sqlx.ExtContext, column string, desc bool) ([]User, error) {
+	order := OrderBy{Column: column, Order: Asc}
+	if desc {
+		order.Order = Desc
+	}
+	clause, err := order.Clause(userOrderColumns)
+	if err != nil {
+		return nil, fmt.Errorf("SelectUsersOrdered: %w", err)
+	}
+
+	users, err := SelectAll[User](ctx, db, "SELECT "+userColumns+" FROM {users} WHERE deleted_at IS NULL ORDER BY "+clause)
+	if err != nil {
+		return nil, fmt.Errorf("SelectUsersOrdered: %w", err)
+	}
+	return users, nil
+}
+
+// LIKE のワイルドカードとして解釈されないように % と _ をエスケープする
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// SQLite の LIKE は ASCII の大文字小文字を区別しない
+func SearchUsersByName(ctx context.Context, db sqlx.ExtContext, prefix string) ([]User, error) {
+	query := "SELECT " + userColumns + ` FROM {users} WHERE deleted_at IS NULL AND name LIKE ? ESCAPE '\' ORDER BY id`
+	users, err := SelectAll[User](ctx, db, query, likeEscaper.Replace(prefix)+"%")
+	if err != nil {
+		return nil, fmt.Errorf("SearchUsersByName: %w", err)
+	}
+	return users, nil
+}
+
+// 1 カラムだけ取る場合は構造体を用意しなくても, そのカラムの型のスライスに Select できる
+// 論理削除された user は含まない
+func SelectUserNames(ctx context.Context, db sqlx.ExtContext) ([]string, error) {
+	names, err := SelectAll[string](ctx, db, "SELECT name FROM {users} WHERE deleted_at IS NULL ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("SelectUserNames: %w", err)
+	}
+	return names, nil
+}
+
+func CountUsers(ctx context.Context, db sqlx.ExtContext) (int, error) {
+	count, err := SelectOne[int](ctx, db, "SELECT COUNT(*) FROM {users} WHERE deleted_at IS NULL")
+	if err != nil {
+		return 0, fmt.Errorf("CountUsers: %w", err)
+	}
+	return count, nil
+}
+
+func GetUserByID(ctx context.Context, db sqlx.ExtContext, id int) (User, error) {
+	// Get は該当行がないと sql.ErrNoRows を返す
+	user, err := SelectOne[User](ctx, db, "SELECT "+userColumns+" FROM {users} WHERE id = ? AND deleted_at IS NULL", id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, fmt.Errorf("GetUserByID: %w", ErrUserNotFound)
+	}
+	if err != nil {
+		return User{}, fmt.Errorf("GetUserByID: %w", err)
+	}
+	return user, nil
+}
+
+// id が最も小さい user. users が空なら ErrUserNotFound を返す
+func FirstUser(ctx context.Context, db sqlx.ExtContext) (User, error) {
+	return edgeUser(ctx, db, "FirstUser", Asc)
+}
+
+// id が最も大きい (最後に作られた) user. users が空なら ErrUserNotFound を返す
+func LastUser(ctx context.Context, db sqlx.ExtContext) (User, error) {
+	return edgeUser(ctx, db, "LastUser", Desc)
+}
+
+func edgeUser(ctx context.Context, db sqlx.ExtContext, op string, order SortOrder) (User, error) {
+	query, args, err := NewUserQuery().OrderBy("id", order).Limit(1).Build()
+	if err != nil {
+		return User{}, fmt.Errorf("%s: %w", op, err)
+	}
+	user, err := SelectOne[User](ctx, db, query, args...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, fmt.Errorf("%s: %w", op, ErrUserNotFound)
+	}
+	if err != nil {
+		return User{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return user, nil
+}
+
+// 採番された id を返す
+// Postgres のドライバは LastInsertId に対応していないので RETURNING で受け取る
+func CreateUser(ctx context.Context, db sqlx.ExtContext, name string) (int, error) {
+	now := time.Now()
+	u := User{Name: name, CreatedAt: now, UpdatedAt: now}
+	if err := u.Validate(); err != nil {
+		return 0, fmt.Errorf("CreateUser: %w", err)
+	}
+	query, args, err := db.BindNamed(insertUsersQuery+" RETURNING id", u)
+	if err != nil {
+		return 0, fmt.Errorf("CreateUser: %w", err)
+	}
+	var id int
+	if err := getContext(ctx, db, &id, query, args...); err != nil {
+		return 0, fmt.Errorf("CreateUser: %w", asConflictError(err))
+	}
+	return id, nil
+}
+
+// name の user があればそれを, なければ作って返す. 作った場合だけ true を返す
+// ON CONFLICT DO NOTHING で挿入を試みるので, 同時に呼ばれても UNIQUE 制約違反にはならない
+// 論理削除された user も既存のものとして返す
+func GetOrCreateUser(ctx context.Context, db *sqlx.DB, name string) (User, bool, error) {
+	now := time.Now()
+	u := User{Name: name, CreatedAt: now, UpdatedAt: now}
+	if err := u.Validate(); err != nil {
+		return User{}, false, fmt.Errorf("GetOrCreateUser: %w", err)
+	}
+
+	var user User
+	var created bool
+	err := WithTx(ctx, db, func(tx *sqlx.Tx) error {
+		query, args, err := tx.BindNamed(insertUsersIgnoreQuery+" RETURNING "+userColumns, u)
+		if err != nil {
+			return err
+		}
+		// 既にあれば何も挿入されず, RETURNING も行を返さない
+		err = getContext(ctx, tx, &user, query, args...)
+		if err == nil {
+			created = true
+			return nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		return getContext(ctx, tx, &user, "SELECT "+userColumns+" FROM {users} WHERE name = ?", name)
+	})
+	if err != nil {
+		return User{}, false, fmt.Errorf("GetOrCreateUser: %w", err)
+	}
+	return user, created, nil
+}
+
+// name が既にあれば更新, なければ挿入する
+// name の重複は更新として扱うので *ConflictError は返さない
+func UpsertUser(ctx context.Context, db sqlx.ExtContext, u User) error {
+	if err := u.Validate(); err != nil {
+		return fmt.Errorf("UpsertUser: %w", err)
+	}
+	now := time.Now()
+	u.CreatedAt, u.UpdatedAt = now, now
+	query := `
+		INSERT INTO {users} (name, created_at, updated_at) VALUES (:name, :created_at, :updated_at)
+		ON CONFLICT(name) DO UPDATE SET name = excluded.name, updated_at = excluded.updated_at
+	`
+	if _, err := namedExecContext(ctx, db, query, u); err != nil {
+		return fmt.Errorf("UpsertUser: %w", err)
+	}
+	return nil
+}
+
+// 同期などで同じ post を何度送っても重複しないように, user_id と content の組で upsert する
+// 既にあれば status と updated_at だけ更新し, どちらの場合も post の id を返す
+// status が空なら既存の post の status はそのまま残す
+func UpsertPost(ctx context.Context, db sqlx.ExtContext, p Post) (int, error) {
+	now := time.Now()
+	p.CreatedAt, p.UpdatedAt = now, now
+	query, args, err := db.BindNamed(insertPostsQuery+`
+		ON CONFLICT(user_id, content) DO UPDATE SET status = COALESCE(:status, {posts}.status), updated_at = excluded.updated_at
+		RETURNING id
+	`, p)
+	if err != nil {
+		return 0, fmt.Errorf("UpsertPost: %w", err)
+	}
+	var id int
+	if err := getContext(ctx, db, &id, query, args...); err != nil {
+		return 0, fmt.Errorf("UpsertPost: %w", err)
+	}
+	return id, nil
+}
+
+// 存在確認だけなら EXISTS を使えば ErrNoRows を気にしなくていい
+func UserExists(ctx context.Context, db sqlx.ExtContext, id int) (bool, error) {
+	var exists bool
+	if err := getContext(ctx, db, &exists, "SELECT EXISTS(SELECT 1 FROM {users} WHERE id = ? AND deleted_at IS NULL)", id); err != nil {
+		return false, fmt.Errorf("UserExists: %w", err)
+	}
+	return exists, nil
+}
+
+// 該当する user がなくてもエラーにはせず, 0 を返す
+func UpdateUser(ctx context.Context, db sqlx.ExtContext, u User) (int64, error) {
+	if err := u.Validate(); err != nil {
+		return 0, fmt.Errorf("UpdateUser: %w", err)
+	}
+	u.UpdatedAt = time.Now()
+	var result sql.Result
+	err := withRetry(defaultRetryAttempts, func() (err error) {
+		result, err = namedExecContext(ctx, db, "UPDATE {users} SET name = :name, updated_at = :updated_at WHERE id = :id", u)
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("UpdateUser: %w", asConflictError(err))
 	}
 	rowsAffected, err := result.RowsAffected()
-	log.Printf("Insert users: %d\n", rowsAffected)
+	if err != nil {
+		return 0, fmt.Errorf("UpdateUser: %w", err)
+	}
+	return rowsAffected, nil
+}
 
-	// Alice has 2 posts, Bob has 1 post, Charlie has no post
-	posts := []Post{
-		{UserID: 1, Content: "Hello, Alice"},
-		{UserID: 1, Content: "Nice to meet you"},
-		{UserID: 2, Content: "Hello, Bob"},
+// UpdateUserFields で更新できるカラム
+var userUpdatableColumns = map[string]bool{
+	"name": true,
+}
+
+// fields に含まれるカラムだけを更新する (updated_at は常に更新する)
+// 該当する user がなければ ErrUserNotFound を返す
+// 例: UpdateUserFields(ctx, db, 1, map[string]any{"name": "Alicia"})
+func UpdateUserFields(ctx context.Context, db sqlx.ExtContext, id int, fields map[string]any) error {
+	if len(fields) == 0 {
+		return fmt.Errorf("UpdateUserFields: no fields to update")
 	}
-	result, err = db.NamedExec("INSERT INTO posts (user_id, content) VALUES (:user_id, :content)", posts)
+	columns, err := allowedColumns(fields, userUpdatableColumns)
 	if err != nil {
-		log.Fatalln(err)
+		return fmt.Errorf("UpdateUserFields: %w", err)
+	}
+	if v, ok := fields["name"]; ok {
+		name, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("UpdateUserFields: %w: name must be a string, got %T", ErrInvalidUser, v)
+		}
+		if err := (User{Name: name}).Validate(); err != nil {
+			return fmt.Errorf("UpdateUserFields: %w", err)
+		}
+	}
+
+	// 呼び出し元の map は書き換えない
+	args := lo.Assign(fields, map[string]any{"id": id, "updated_at": time.Now()})
+	sets := lo.Map(append(columns, "updated_at"), func(c string, _ int) string {
+		return c + " = :" + c
+	})
+	query := "UPDATE {users} SET " + strings.Join(sets, ", ") + " WHERE id = :id"
+
+	result, err := namedExecContext(ctx, db, query, args)
+	if err != nil {
+		return fmt.Errorf("UpdateUserFields: %w", asConflictError(err))
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("UpdateUserFields: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("UpdateUserFields: %w", ErrUserNotFound)
 	}
-	rowsAffected, err = result.RowsAffected()
-	log.Printf("Insert posts: %d\n", rowsAffected)
+	return nil
 }
 
-func SelectUsers(db *sqlx.DB) {
-	users := []User{}
-	err := db.Select(&users, "SELECT * FROM users")
+// 行は残したまま deleted_at を埋める
+// 既に論理削除されている場合は削除した日時を上書きしない
+//
+// users を読む関数は論理削除された user を含まない. 例外は次のとおり
+//   - SelectUsersIncludingDeleted: 論理削除された user も含めて返す
+//   - GetOrCreateUser, UpsertUser: name の UNIQUE 制約は論理削除された行にも効くので, その行を既存のものとして扱う
+//   - UpdateUser, UpdateUserFields, DeleteUser, DeleteUsersByIDs: id を指定した書き込みは論理削除された user にも効く
+//   - posts だけを読む関数 (PostsByUser, RecentPosts, PostCountsByUser など): posts は残るので含まれる
+func SoftDeleteUser(ctx context.Context, db sqlx.ExtContext, id int) error {
+	now := time.Now()
+	query := "UPDATE {users} SET deleted_at = ?, updated_at = ? WHERE id = ? AND deleted_at IS NULL"
+	if _, err := execContext(ctx, db, query, now, now, id); err != nil {
+		return fmt.Errorf("SoftDeleteUser: %w", err)
+	}
+	return nil
+}
+
+// posts は外部キーの ON DELETE CASCADE で消えるので, users を消すだけでいい
+func DeleteUser(ctx context.Context, db sqlx.ExtContext, id int) error {
+	if _, err := execContext(ctx, db, "DELETE FROM {users} WHERE id = ?", id); err != nil {
+		return fmt.Errorf("DeleteUser: %w", err)
+	}
+	return nil
+}
+
+// 削除した users の件数を返す. 存在しない id は無視する
+// DeleteUser と同じく, posts は外部キーの ON DELETE CASCADE で消える
+func DeleteUsersByIDs(ctx context.Context, db sqlx.ExtContext, ids []int) (int64, error) {
+	// sqlx.In は空のスライスを渡すとエラーになる
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	result, err := InExec(ctx, db, "DELETE FROM {users} WHERE id IN (?)", ids)
 	if err != nil {
-		log.Fatalln(err)
+		return 0, fmt.Errorf("DeleteUsersByIDs: %w", err)
 	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("DeleteUsersByIDs: %w", err)
+	}
+	return rowsAffected, nil
+}
 
-	// [{1 Alice} {2 Bob} {3 Charlie}]
-	log.Println("All users:", users)
+// DB には問い合わせず, 展開とプレースホルダの書き換えが済んだ SQL と引数を返す
+// ログに出したりテストで確認したりする用. InQuery, SelectUsersByIDs はこれが返した SQL をそのまま実行する
+func BuildInQuery(db sqlx.ExtContext, ids []int) (string, []any, error) {
+	query, args, err := sqlx.In("SELECT "+userColumns+" FROM {users} WHERE deleted_at IS NULL AND id IN (?)", ids)
+	if err != nil {
+		return "", nil, fmt.Errorf("BuildInQuery: %w", err)
+	}
+	return q(db, query), args, nil
 }
 
-func InQuery(db *sqlx.DB) {
-	userIDs := []int{1, 2}
-	query, args, _ := sqlx.In("SELECT * FROM users WHERE id IN (?)", userIDs)
-	query = db.Rebind(query)
+func InQuery(ctx context.Context, db sqlx.ExtContext, userIDs []int) ([]User, error) {
+	query, args, err := BuildInQuery(db, userIDs)
+	if err != nil {
+		return nil, fmt.Errorf("InQuery: %w", err)
+	}
 
-	var users []User
-	if err := db.Select(&users, query, args...); err != nil {
-		log.Fatalln(err)
+	users := []User{}
+	if err := selectContext(ctx, db, &users, query, args...); err != nil {
+		return nil, fmt.Errorf("InQuery.select: %w", err)
 	}
+	return users, nil
+}
 
-	// [{1 Alice} {2 Bob}]
-	log.Println("Selected users:", users)
+// SQLite のバインド変数は (古いバージョンだと) 999 個までなので, それより小さく区切る
+const inQueryChunkSize = 500
+
+// ids が多くてもバインド変数の上限を超えないように分割して問い合わせる
+// 重複した id は 1 件にまとめる
+func SelectUsersByIDs(ctx context.Context, db sqlx.ExtContext, ids []int) ([]User, error) {
+	users := []User{}
+	for _, chunk := range lo.Chunk(lo.Uniq(ids), inQueryChunkSize) {
+		query, args, err := BuildInQuery(db, chunk)
+		if err != nil {
+			return nil, fmt.Errorf("SelectUsersByIDs: %w", err)
+		}
+		var chunkUsers []User
+		if err := selectContext(ctx, db, &chunkUsers, query, args...); err != nil {
+			return nil, fmt.Errorf("SelectUsersByIDs: %w", err)
+		}
+		users = append(users, chunkUsers...)
+	}
+	return users, nil
 }
 
-func JoinQuery(db *sqlx.DB) {
-	// users.id, posts.id のタグが被るので, 少なくとも一方のタグは必須
-	// マッピング先が一意ならタグ, AS は不要
-	type T struct {
-		User `db:"user"`
-		Post
+func SelectUsersByNames(ctx context.Context, db sqlx.ExtContext, names []string) ([]User, error) {
+	// sqlx.In は空のスライスを渡すとエラーになる
+	// IN () は SQL として不正なので, 問い合わせずに空で返す
+	if len(names) == 0 {
+		return []User{}, nil
+	}
+	users := []User{}
+	if err := InSelect(ctx, db, "SELECT "+userColumns+" FROM {users} WHERE deleted_at IS NULL AND name IN (?) ORDER BY id", names, &users); err != nil {
+		return nil, fmt.Errorf("SelectUsersByNames: %w", err)
+	}
+	return users, nil
+}
+
+// SelectUsersByIDs を名前付きパラメータで書いたもの
+// 他の名前付きの条件と組み合わせるときはこちらの書き方に揃える
+func SelectUsersInNamed(ctx context.Context, db sqlx.ExtContext, ids []int) ([]User, error) {
+	users := []User{}
+	if len(ids) == 0 {
+		return users, nil
 	}
+	// Named で :ids を ? にしてから, In でスライスを ?, ?, ... に展開する
+	// 順番が逆だと In が :ids を見つけられない
+	// ドライバのプレースホルダへの書き換えは最後に selectContext が行う
+	query, args, err := sqlx.Named("SELECT "+userColumns+" FROM {users} WHERE deleted_at IS NULL AND id IN (:ids) ORDER BY id", map[string]any{"ids": ids})
+	if err != nil {
+		return nil, fmt.Errorf("SelectUsersInNamed.named: %w", err)
+	}
+	query, args, err = sqlx.In(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("SelectUsersInNamed.in: %w", err)
+	}
+	if err := selectContext(ctx, db, &users, query, args...); err != nil {
+		return nil, fmt.Errorf("SelectUsersInNamed.select: %w", err)
+	}
+	return users, nil
+}
 
+// 指定した user の posts を 1 回のクエリで取得して user_id ごとにまとめる
+// posts がない user も空のスライスとしてキーを持つ
+func PostsByUser(ctx context.Context, db sqlx.ExtContext, userIDs []int) (map[int][]Post, error) {
+	result := make(map[int][]Post, len(userIDs))
+	// sqlx.In は空のスライスを渡すとエラーになる
+	if len(userIDs) == 0 {
+		return result, nil
+	}
+
+	var posts []Post
+	if err := InSelect(ctx, db, "SELECT "+postColumns+" FROM {posts} WHERE user_id IN (?) ORDER BY id", userIDs, &posts); err != nil {
+		return nil, fmt.Errorf("PostsByUser: %w", err)
+	}
+
+	for _, id := range userIDs {
+		result[id] = []Post{}
+	}
+	for _, p := range posts {
+		result[p.UserID] = append(result[p.UserID], p)
+	}
+	return result, nil
+}
+
+// user が存在しなければ ErrUserNotFound を返す
+// posts がなければ空のスライスを返す
+func GetUserWithPosts(ctx context.Context, db sqlx.ExtContext, userID int) (User, []Post, error) {
+	user, err := GetUserByID(ctx, db, userID)
+	if err != nil {
+		return User{}, nil, fmt.Errorf("GetUserWithPosts.user: %w", err)
+	}
+
+	posts := []Post{}
+	if err := selectContext(ctx, db, &posts, "SELECT "+postColumns+" FROM {posts} WHERE user_id = ? ORDER BY id", userID); err != nil {
+		return User{}, nil, fmt.Errorf("GetUserWithPosts.posts: %w", err)
+	}
+	return user, posts, nil
+}
+
+// users.id, posts.id のタグが被るので, 少なくとも一方のタグは必須
+// マッピング先が一意ならタグ, AS は不要
+// JSON でもキーが被るので入れ子にする
+type UserPostJoin struct {
+	User `db:"user" json:"user"`
+	Post `json:"post"`
+}
+
+func JoinQuery(ctx context.Context, db sqlx.ExtContext) ([]UserPostJoin, error) {
 	// LEFT JOIN だと NULL をマッピングできなくてエラーになる
 	// *Post を埋め込んでもダメ
 	// refs: https://github.com/jmoiron/sqlx/issues/162
@@ -132,77 +1049,259 @@ func JoinQuery(db *sqlx.DB) {
 		SELECT
 			users.id AS "user.id",
 			users.name AS "user.name",
-			posts.*
-		FROM users
-		INNER JOIN posts ON users.id = posts.user_id
+			users.created_at AS "user.created_at",
+			users.updated_at AS "user.updated_at",
+			users.deleted_at AS "user.deleted_at",
+			` + qualifiedColumns("posts", Columns[Post]()) + `
+		FROM {users} AS users
+		INNER JOIN {posts} AS posts ON users.id = posts.user_id
+		WHERE users.deleted_at IS NULL
 	`
-	var result []T
-	if err := db.Select(&result, query); err != nil {
-		log.Fatalln(err)
+	var result []UserPostJoin
+	if err := selectContext(ctx, db, &result, query); err != nil {
+		return nil, fmt.Errorf("JoinQuery: %w", err)
 	}
+	return result, nil
+}
+
+// posts を 1 件以上持つ user を 1 回ずつ返す
+// INNER JOIN だけだと posts の数だけ user が重複するので DISTINCT で潰す
+func UsersWithAnyPost(ctx context.Context, db sqlx.ExtContext) ([]User, error) {
+	query := `
+		SELECT DISTINCT ` + qualifiedColumns("users", Columns[User]()) + `
+		FROM {users} AS users
+		INNER JOIN {posts} AS posts ON users.id = posts.user_id
+		WHERE users.deleted_at IS NULL
+		ORDER BY users.id
+	`
+	users, err := SelectAll[User](ctx, db, query)
+	if err != nil {
+		return nil, fmt.Errorf("UsersWithAnyPost: %w", err)
+	}
+	return users, nil
+}
 
-	// [{{1 Alice} {1 1 Hello, Alice}} {{1 Alice} {2 1 Nice to meet you}} {{2 Bob} {3 2 Hello, Bob}}]
-	log.Println("Joined result:", result)
+type UserWithOptionalPost struct {
+	User User `json:"user"`
+	// posts がない user は nil
+	Post *Post `json:"post"`
 }
 
-func SelectUserPosts(db *sqlx.DB) {
-	// 素の JOIN された状態で取得
+// JoinQuery の LEFT JOIN 版
+// posts 側は sql.Null で受けてから *Post を組み立てる
+func LeftJoinQuery(ctx context.Context, db sqlx.ExtContext) ([]UserWithOptionalPost, error) {
 	type T struct {
-		UserID  int           `db:"user_id"`
-		PostID  sql.Null[int] `db:"post_id"`
-		Content sql.Null[string]
+		User `db:"user"`
+		nullPost
 	}
 	query := `
-		SELECT users.id AS user_id, posts.id AS post_id, posts.content
-		FROM users
-		LEFT JOIN posts ON users.id = posts.user_id
+		SELECT
+			users.id AS "user.id",
+			users.name AS "user.name",
+			users.created_at AS "user.created_at",
+			users.updated_at AS "user.updated_at",
+			users.deleted_at AS "user.deleted_at",
+			posts.id AS post_id,
+			posts.content AS post_content,
+			posts.status AS post_status,
+			posts.metadata AS post_metadata,
+			posts.created_at AS post_created_at,
+			posts.updated_at AS post_updated_at
+		FROM {users} AS users
+		LEFT JOIN {posts} AS posts ON users.id = posts.user_id
+		WHERE users.deleted_at IS NULL
+		ORDER BY users.id, posts.id
 	`
-	var flatResult []T
-	if err := db.Select(&flatResult, query); err != nil {
-		log.Fatalln(err)
+	var rows []T
+	if err := selectContext(ctx, db, &rows, query); err != nil {
+		return nil, fmt.Errorf("LeftJoinQuery: %w", err)
 	}
 
-	// きっちり整形する場合
-	{
-		grouped := lo.GroupBy(flatResult, func(v T) int {
-			return v.UserID
-		})
-		result := lo.MapValues(grouped, func(value []T, key int) []Post {
-			return lo.FilterMap(value, func(v T, _ int) (Post, bool) {
-				if !v.PostID.Valid {
-					return Post{}, false
-				}
-				return Post{
-					ID:      v.PostID.V,
-					UserID:  v.UserID,
-					Content: v.Content.V,
-				}, true
-			})
-		})
-		// map[1:[{1 1 Hello, Alice} {2 1 Nice to meet you}] 2:[{3 2 Hello, Bob}] 3:[]]
-		log.Println("User posts:", result)
-	}
-
-	// 別の方法
-	{
-		// 先に filter map
-		// INNER JOIN した場合と同じになる
-		// 消えたキーに関する情報 (User) は元データを参照すればいい
-		mapped := lo.FilterMap(flatResult, func(item T, _ int) (Post, bool) {
-			if !item.PostID.Valid {
-				return Post{}, false
-			}
-			return Post{
-				ID:      item.PostID.V,
-				UserID:  item.UserID,
-				Content: item.Content.V,
-			}, true
-		})
-		// 存在しないキーは [] として扱えばいい
-		result := lo.GroupBy(mapped, func(p Post) int {
-			return p.UserID
+	result := lo.Map(rows, func(r T, _ int) UserWithOptionalPost {
+		v := UserWithOptionalPost{User: r.User}
+		if p, ok := r.toPost(r.User.ID); ok {
+			v.Post = &p
+		}
+		return v
+	})
+	return result, nil
+}
+
+func SelectUsersWithPosts(ctx context.Context, db sqlx.ExtContext) ([]UserWithPosts, error) {
+	rows, err := LeftJoinQuery(ctx, db)
+	if err != nil {
+		return nil, fmt.Errorf("SelectUsersWithPosts: %w", err)
+	}
+	return PreloadPosts(rows), nil
+}
+
+// LEFT JOIN で posts 側のカラムは NULL になりうるので sql.Null で受ける
+// カラム名は post_ を付けて users 側と被らないようにする
+type nullPost struct {
+	PostID      sql.Null[int]        `db:"post_id"`
+	PostContent sql.Null[string]     `db:"post_content"`
+	PostStatus  sql.Null[PostStatus] `db:"post_status"`
+	// NULL は PostMetadata の Scan が nil にするので sql.Null で包まなくていい
+	PostMetadata  PostMetadata        `db:"post_metadata"`
+	PostCreatedAt sql.Null[time.Time] `db:"post_created_at"`
+	PostUpdatedAt sql.Null[time.Time] `db:"post_updated_at"`
+}
+
+// post が NULL (JOIN 先がない) なら false を返す
+// user_id は JOIN 元の users.id を使う
+func (n nullPost) toPost(userID int) (Post, bool) {
+	if !n.PostID.Valid {
+		return Post{}, false
+	}
+	return Post{
+		ID:        n.PostID.V,
+		UserID:    userID,
+		Content:   NullToZero(n.PostContent),
+		Status:    NullToZero(n.PostStatus),
+		Metadata:  n.PostMetadata,
+		CreatedAt: NullToZero(n.PostCreatedAt),
+		UpdatedAt: NullToZero(n.PostUpdatedAt),
+	}, true
+}
+
+// 素の JOIN された状態で取得した 1 行
+// posts がない user は post 側のフィールドが全て NULL になる
+type UserPostRow struct {
+	UserID int `db:"user_id"`
+	nullPost
+}
+
+// posts がない行 (PostID が NULL) なら false を返す
+func (r UserPostRow) ToPost() (Post, bool) {
+	return r.toPost(r.UserID)
+}
+
+// UserPostRow を user_id ごとにまとめたもの
+type UserPosts struct {
+	UserID int    `json:"user_id"`
+	Posts  []Post `json:"posts"`
+}
+
+func selectUserPostRows(ctx context.Context, db sqlx.ExtContext) ([]UserPostRow, error) {
+	query := `
+		SELECT
+			users.id AS user_id,
+			posts.id AS post_id,
+			posts.content AS post_content,
+			posts.status AS post_status,
+			posts.metadata AS post_metadata,
+			posts.created_at AS post_created_at,
+			posts.updated_at AS post_updated_at
+		FROM {users} AS users
+		LEFT JOIN {posts} AS posts ON users.id = posts.user_id
+		WHERE users.deleted_at IS NULL
+		ORDER BY users.id, posts.id
+	`
+	var flatResult []UserPostRow
+	if err := selectContext(ctx, db, &flatResult, query); err != nil {
+		return nil, err
+	}
+	return flatResult, nil
+}
+
+// map は順序を持たないので user_id 順に並べる
+func sortedUserPosts(grouped map[int][]Post) []UserPosts {
+	result := lo.MapToSlice(grouped, func(userID int, posts []Post) UserPosts {
+		return UserPosts{UserID: userID, Posts: posts}
+	})
+	slices.SortFunc(result, func(a, b UserPosts) int { return a.UserID - b.UserID })
+	return result
+}
+
+// きっちり整形する場合
+// posts がない user も空の Posts を持つ
+func SelectUserPosts(ctx context.Context, db sqlx.ExtContext) ([]UserPosts, error) {
+	flatResult, err := selectUserPostRows(ctx, db)
+	if err != nil {
+		return nil, fmt.Errorf("SelectUserPosts: %w", err)
+	}
+
+	grouped := GroupByUserID(flatResult, func(v UserPostRow) int {
+		return v.UserID
+	})
+	result := lo.MapValues(grouped, func(value []UserPostRow, key int) []Post {
+		return lo.FilterMap(value, func(v UserPostRow, _ int) (Post, bool) {
+			return v.ToPost()
 		})
-		// map[1:[{1 1 Hello, Alice} {2 1 Nice to meet you}] 2:[{3 2 Hello, Bob}]]
-		log.Println("User posts:", result)
+	})
+	return sortedUserPosts(result), nil
+}
+
+// 別の方法
+func SelectUserPostsSparse(ctx context.Context, db sqlx.ExtContext) ([]UserPosts, error) {
+	flatResult, err := selectUserPostRows(ctx, db)
+	if err != nil {
+		return nil, fmt.Errorf("SelectUserPostsSparse: %w", err)
+	}
+
+	// 先に filter map
+	// INNER JOIN した場合と同じになる
+	// 消えたキーに関する情報 (User) は元データを参照すればいい
+	mapped := lo.FilterMap(flatResult, func(item UserPostRow, _ int) (Post, bool) {
+		return item.ToPost()
+	})
+	// 存在しない user は posts が [] だと思えばいい
+	result := GroupByUserID(mapped, func(p Post) int {
+		return p.UserID
+	})
+	return sortedUserPosts(result), nil
+}
+
+// posts を持たない user はキーに含まれない
+// 存在しないキーは map のゼロ値で 0 になるので, 読む側で困ることはない
+func PostCountsByUser(ctx context.Context, db sqlx.ExtContext) (map[int]int, error) {
+	type row struct {
+		UserID int `db:"user_id"`
+		Count  int `db:"count"`
+	}
+	rows, err := SelectAll[row](ctx, db, "SELECT user_id, COUNT(*) AS count FROM {posts} GROUP BY user_id")
+	if err != nil {
+		return nil, fmt.Errorf("PostCountsByUser: %w", err)
+	}
+	return lo.SliceToMap(rows, func(r row) (int, int) {
+		return r.UserID, r.Count
+	}), nil
+}
+
+// 全 user の posts を新しい順に返す
+// created_at が同じ posts は後から挿入された (id が大きい) 方を先にする
+// limit が 0 なら件数制限なし, 負の値はエラー
+func RecentPosts(ctx context.Context, db sqlx.ExtContext, limit int) ([]Post, error) {
+	if limit < 0 {
+		return nil, fmt.Errorf("RecentPosts: invalid limit: %d", limit)
+	}
+	posts, err := SelectAll[Post](ctx, db, "SELECT "+postColumns+" FROM {posts} ORDER BY created_at DESC, id DESC LIMIT ?", sqlLimit(limit))
+	if err != nil {
+		return nil, fmt.Errorf("RecentPosts: %w", err)
+	}
+	return posts, nil
+}
+
+// フィード用に posts に投稿者の名前を付けたもの
+// users 側は name だけを author_name として取るので, users.id と posts.id のタグは被らない
+type PostWithAuthor struct {
+	Post
+	AuthorName string `db:"author_name" json:"author_name"`
+}
+
+func PostsWithAuthors(ctx context.Context, db sqlx.ExtContext) ([]PostWithAuthor, error) {
+	query := `
+		SELECT
+			` + qualifiedColumns("posts", Columns[Post]()) + `,
+			users.name AS author_name
+		FROM {posts} AS posts
+		INNER JOIN {users} AS users ON users.id = posts.user_id
+		WHERE users.deleted_at IS NULL
+		ORDER BY posts.id
+	`
+	posts, err := SelectAll[PostWithAuthor](ctx, db, query)
+	if err != nil {
+		return nil, fmt.Errorf("PostsWithAuthors: %w", err)
 	}
+	return posts, nil
 }
@@ -0,0 +1,1305 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/mattn/go-sqlite3"
+)
+
+// マイグレーションだけ済ませた空の DB
+// ":memory:" は接続ごとに別の DB になるので, 接続を 1 つに絞る
+func newTestDB(t testing.TB) *sqlx.DB {
+	t.Helper()
+	db, err := InitDB("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	if err := Migrate(context.Background(), db, SchemaMigrations(DialectFor(db.DriverName()))); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// 複数の接続から同じ DB を使うテスト用. ファイルはテストの終わりに消える
+func newFileTestDB(t *testing.T) *sqlx.DB {
+	t.Helper()
+	db, err := InitDB("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err := Migrate(context.Background(), db, SchemaMigrations(DialectFor(db.DriverName()))); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// Seed のデータ (Alice, Bob, Charlie と 3 件の posts) を入れた DB
+func newSeededTestDB(t *testing.T) *sqlx.DB {
+	t.Helper()
+	db := newTestDB(t)
+	if err := Seed(context.Background(), db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// user1, user2, ... の n 人を id 順に入れる
+func insertUsers(t *testing.T, db *sqlx.DB, n int) {
+	t.Helper()
+	users := make([]User, n)
+	for i := range users {
+		users[i] = User{Name: fmt.Sprintf("user%d", i+1)}
+	}
+	if _, _, err := BulkInsert(context.Background(), db, users, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGetUserByID(t *testing.T) {
+	db := newSeededTestDB(t)
+	ctx := context.Background()
+
+	user, err := GetUserByID(ctx, db, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != 1 || user.Name != "Alice" {
+		t.Errorf("GetUserByID(1) = %+v, want Alice", user)
+	}
+
+	if _, err := GetUserByID(ctx, db, 999); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("GetUserByID(999) error = %v, want ErrUserNotFound", err)
+	}
+}
+
+func TestSelectUsersCanceledContext(t *testing.T) {
+	db := newSeededTestDB(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := SelectUsers(ctx, db); !errors.Is(err, context.Canceled) {
+		t.Errorf("SelectUsers error = %v, want context.Canceled", err)
+	}
+}
+
+func TestSelectUsersReturnsError(t *testing.T) {
+	db := newSeededTestDB(t)
+	ctx := context.Background()
+	if _, err := db.ExecContext(ctx, "DROP TABLE posts"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.ExecContext(ctx, "DROP TABLE users"); err != nil {
+		t.Fatal(err)
+	}
+
+	// log.Fatalln で終了せず, エラーとして返ってくる
+	if _, err := SelectUsers(ctx, db); err == nil {
+		t.Error("SelectUsers on a dropped table returned no error")
+	}
+}
+
+func TestBulkInsertTxRollsBack(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+
+	users := []User{{Name: "Alice"}, {Name: "Bob"}}
+	posts := []Post{{UserID: 999, Content: "Hello, nobody"}}
+	if err := BulkInsertTx(ctx, db, users, posts); err == nil {
+		t.Fatal("BulkInsertTx with an orphan post returned no error")
+	}
+
+	got, err := SelectUsers(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Errorf("SelectUsers = %v, want no users", got)
+	}
+}
+
+func TestForeignKeysEnabled(t *testing.T) {
+	db := newSeededTestDB(t)
+
+	if _, _, err := BulkInsert(context.Background(), db, nil, []Post{{UserID: 999, Content: "Hello, nobody"}}); err == nil {
+		t.Error("BulkInsert of a post with user_id 999 returned no error")
+	}
+}
+
+func TestUpdateUser(t *testing.T) {
+	db := newSeededTestDB(t)
+	ctx := context.Background()
+
+	id := 1
+	n, err := UpdateUser(ctx, db, User{ID: id, Name: "Alicia"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("UpdateUser rows affected = %d, want 1", n)
+	}
+
+	user, err := GetUserByID(ctx, db, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Name != "Alicia" {
+		t.Errorf("Name = %q, want %q", user.Name, "Alicia")
+	}
+}
+
+func TestDeleteUser(t *testing.T) {
+	db := newSeededTestDB(t)
+	ctx := context.Background()
+
+	if err := DeleteUser(ctx, db, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := GetUserByID(ctx, db, 1); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("GetUserByID(1) error = %v, want ErrUserNotFound", err)
+	}
+	for userID, want := range map[int]int{1: 0, 2: 1} {
+		var n int
+		if err := db.GetContext(ctx, &n, "SELECT COUNT(*) FROM posts WHERE user_id = ?", userID); err != nil {
+			t.Fatal(err)
+		}
+		if n != want {
+			t.Errorf("posts of user %d = %d, want %d", userID, n, want)
+		}
+	}
+}
+
+func TestBulkInsertSetsTimestamps(t *testing.T) {
+	db := newSeededTestDB(t)
+	ctx := context.Background()
+
+	user, err := GetUserByID(ctx, db, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.CreatedAt.IsZero() {
+		t.Fatal("CreatedAt is zero")
+	}
+	if d := time.Since(user.CreatedAt); d < 0 || d > time.Second {
+		t.Errorf("CreatedAt = %v, want within a second of now", user.CreatedAt)
+	}
+	if !user.UpdatedAt.Equal(user.CreatedAt) {
+		t.Errorf("UpdatedAt = %v, want %v", user.UpdatedAt, user.CreatedAt)
+	}
+}
+
+func TestCountUsers(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("empty", func(t *testing.T) {
+		count, err := CountUsers(ctx, newTestDB(t))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != 0 {
+			t.Errorf("CountUsers = %d, want 0", count)
+		}
+	})
+	t.Run("three users", func(t *testing.T) {
+		db := newTestDB(t)
+		insertUsers(t, db, 3)
+		count, err := CountUsers(ctx, db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != 3 {
+			t.Errorf("CountUsers = %d, want 3", count)
+		}
+	})
+}
+
+func TestPostsByUser(t *testing.T) {
+	db := newSeededTestDB(t)
+
+	posts, err := PostsByUser(context.Background(), db, []int{1, 2, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, want := range map[int]int{1: 2, 2: 1, 3: 0} {
+		got, ok := posts[id]
+		if !ok {
+			t.Errorf("user %d has no key", id)
+			continue
+		}
+		if len(got) != want {
+			t.Errorf("len(posts[%d]) = %d, want %d", id, len(got), want)
+		}
+	}
+}
+
+func TestLeftJoinQuery(t *testing.T) {
+	db := newSeededTestDB(t)
+
+	rows, err := LeftJoinQuery(context.Background(), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Alice の 2 件, Bob の 1 件, Charlie の posts なしの 1 行
+	if len(rows) != 4 {
+		t.Fatalf("len(rows) = %d, want 4", len(rows))
+	}
+	var found bool
+	for _, r := range rows {
+		if r.User.Name != "Charlie" {
+			if r.Post == nil {
+				t.Errorf("%s has a nil Post", r.User.Name)
+			}
+			continue
+		}
+		found = true
+		if r.Post != nil {
+			t.Errorf("Charlie's Post = %+v, want nil", r.Post)
+		}
+	}
+	if !found {
+		t.Error("Charlie is missing from the result")
+	}
+}
+
+func TestUserExists(t *testing.T) {
+	db := newSeededTestDB(t)
+	ctx := context.Background()
+
+	for id, want := range map[int]bool{1: true, 999: false} {
+		got, err := UserExists(ctx, db, id)
+		if err != nil {
+			t.Fatalf("UserExists(%d): %v", id, err)
+		}
+		if got != want {
+			t.Errorf("UserExists(%d) = %v, want %v", id, got, want)
+		}
+	}
+}
+
+func TestInitDBInMemory(t *testing.T) {
+	db := newTestDB(t)
+
+	var tables []string
+	if err := db.Select(&tables, "SELECT name FROM sqlite_master WHERE type = 'table' AND name IN ('users', 'posts') ORDER BY name"); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"posts", "users"}; !slices.Equal(tables, want) {
+		t.Errorf("tables = %v, want %v", tables, want)
+	}
+}
+
+func TestUpsertUser(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+
+	for range 2 {
+		if err := UpsertUser(ctx, db, User{Name: "Alice"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	count, err := CountUsers(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("CountUsers = %d, want 1", count)
+	}
+}
+
+func userNames(users []User) []string {
+	names := make([]string, len(users))
+	for i, u := range users {
+		names[i] = u.Name
+	}
+	return names
+}
+
+func TestSelectUsersOrdered(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	// id 順と名前順が違うように入れる
+	if _, _, err := BulkInsert(ctx, db, []User{{Name: "Charlie"}, {Name: "Alice"}, {Name: "Bob"}}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	users, err := SelectUsersOrdered(ctx, db, "name", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := userNames(users), []string{"Alice", "Bob", "Charlie"}; !slices.Equal(got, want) {
+		t.Errorf("name asc = %v, want %v", got, want)
+	}
+
+	users, err = SelectUsersOrdered(ctx, db, "id", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := userIDs(users), []int{3, 2, 1}; !slices.Equal(got, want) {
+		t.Errorf("id desc = %v, want %v", got, want)
+	}
+
+	if _, err := SelectUsersOrdered(ctx, db, "name; DROP TABLE users", false); err == nil {
+		t.Error("SelectUsersOrdered accepted an injected column")
+	}
+	if count, err := CountUsers(ctx, db); err != nil || count != 3 {
+		t.Errorf("CountUsers = %d, %v, want 3", count, err)
+	}
+}
+
+func TestSearchUsersByName(t *testing.T) {
+	db := newSeededTestDB(t)
+	ctx := context.Background()
+	if _, _, err := BulkInsert(ctx, db, []User{{Name: "user_1"}, {Name: "userx1"}}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		prefix string
+		want   []string
+	}{
+		{"A", []string{"Alice"}},
+		// _ は 1 文字のワイルドカードではなく, 文字として扱う
+		{"user_", []string{"user_1"}},
+	}
+	for _, tt := range tests {
+		users, err := SearchUsersByName(ctx, db, tt.prefix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := userNames(users); !slices.Equal(got, tt.want) {
+			t.Errorf("SearchUsersByName(%q) = %v, want %v", tt.prefix, got, tt.want)
+		}
+	}
+}
+
+func TestBulkInsertErrorWrapping(t *testing.T) {
+	db := newSeededTestDB(t)
+
+	_, _, err := BulkInsert(context.Background(), db, nil, []Post{{UserID: 999, Content: "Hello, nobody"}})
+	if err == nil {
+		t.Fatal("BulkInsert of an orphan post returned no error")
+	}
+	if !strings.Contains(err.Error(), "BulkInsert.posts") {
+		t.Errorf("error %q does not contain the operation name", err)
+	}
+	// sqlite3.Error は値に比較できるフィールドを持たないので, errors.Is ではなく errors.As で取り出す
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) {
+		t.Fatalf("error %v does not wrap a sqlite3.Error", err)
+	}
+	if sqliteErr.ExtendedCode != sqlite3.ErrConstraintForeignKey {
+		t.Errorf("ExtendedCode = %v, want ErrConstraintForeignKey", sqliteErr.ExtendedCode)
+	}
+}
+
+func TestBulkUpdatePosts(t *testing.T) {
+	db := newSeededTestDB(t)
+	ctx := context.Background()
+
+	n, err := BulkUpdatePosts(ctx, db, []Post{{ID: 1, Content: "Updated 1"}, {ID: 3, Content: "Updated 3"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("rows affected = %d, want 2", n)
+	}
+
+	var posts []Post
+	if err := db.SelectContext(ctx, &posts, "SELECT * FROM posts WHERE id IN (1, 3) ORDER BY id"); err != nil {
+		t.Fatal(err)
+	}
+	if len(posts) != 2 || posts[0].Content != "Updated 1" || posts[1].Content != "Updated 3" {
+		t.Errorf("posts = %+v, want both contents updated", posts)
+	}
+}
+
+func TestSelectUsersInTx(t *testing.T) {
+	db := newSeededTestDB(t)
+
+	tx, err := db.Beginx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	users, err := SelectUsers(context.Background(), tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 3 {
+		t.Errorf("SelectUsers in tx = %v, want 3 users", users)
+	}
+}
+
+func TestUsersJSON(t *testing.T) {
+	db := newSeededTestDB(t)
+
+	b, err := UsersJSON(context.Background(), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var users []map[string]any
+	if err := json.Unmarshal(b, &users); err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 3 {
+		t.Fatalf("len(users) = %d, want 3", len(users))
+	}
+	// deleted_at は論理削除されていなければ omitempty で出ない
+	keys := slices.Sorted(maps.Keys(users[0]))
+	if want := []string{"created_at", "id", "name", "updated_at"}; !slices.Equal(keys, want) {
+		t.Errorf("keys = %v, want %v", keys, want)
+	}
+}
+
+func TestCreateUser(t *testing.T) {
+	db := newSeededTestDB(t)
+	ctx := context.Background()
+
+	id, err := CreateUser(ctx, db, "Dave")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := GetUserByID(ctx, db, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Name != "Dave" {
+		t.Errorf("GetUserByID(%d).Name = %q, want %q", id, user.Name, "Dave")
+	}
+}
+
+func TestGetUserWithPosts(t *testing.T) {
+	db := newSeededTestDB(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		id    int
+		name  string
+		posts int
+	}{
+		{1, "Alice", 2},
+		{3, "Charlie", 0},
+	}
+	for _, tt := range tests {
+		user, posts, err := GetUserWithPosts(ctx, db, tt.id)
+		if err != nil {
+			t.Fatalf("GetUserWithPosts(%d): %v", tt.id, err)
+		}
+		if user.Name != tt.name || len(posts) != tt.posts {
+			t.Errorf("GetUserWithPosts(%d) = %s with %d posts, want %s with %d", tt.id, user.Name, len(posts), tt.name, tt.posts)
+		}
+	}
+
+	if _, _, err := GetUserWithPosts(ctx, db, 999); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("GetUserWithPosts(999) error = %v, want ErrUserNotFound", err)
+	}
+}
+
+func TestSoftDeleteUser(t *testing.T) {
+	db := newSeededTestDB(t)
+	ctx := context.Background()
+
+	if err := SoftDeleteUser(ctx, db, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	users, err := SelectUsers(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := userNames(users), []string{"Bob", "Charlie"}; !slices.Equal(got, want) {
+		t.Errorf("SelectUsers = %v, want %v", got, want)
+	}
+	users, err = SelectUsersIncludingDeleted(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := userNames(users), []string{"Alice", "Bob", "Charlie"}; !slices.Equal(got, want) {
+		t.Errorf("SelectUsersIncludingDeleted = %v, want %v", got, want)
+	}
+	if users[0].DeletedAt == nil {
+		t.Error("Alice's DeletedAt is nil")
+	}
+	if _, err := GetUserByID(ctx, db, 1); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("GetUserByID(1) error = %v, want ErrUserNotFound", err)
+	}
+}
+
+func TestBuildInQuery(t *testing.T) {
+	db := newTestDB(t)
+	ids := []int{1, 2, 3}
+
+	query, args, err := BuildInQuery(db, ids)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Count(query, "?"); got != len(ids) {
+		t.Errorf("placeholders in %q = %d, want %d", query, got, len(ids))
+	}
+	if len(args) != len(ids) {
+		t.Errorf("args = %v, want %d args", args, len(ids))
+	}
+	if strings.Contains(query, "{users}") {
+		t.Errorf("query %q still has a table token", query)
+	}
+
+	// InQuery は BuildInQuery が返した SQL をそのまま実行する
+	h := &recordingHandler{}
+	if _, err := InQuery(context.Background(), NewLoggingDB(db, slog.New(h)), ids); err != nil {
+		t.Fatal(err)
+	}
+	if records := h.Records(); len(records) != 1 || recordAttrs(records[0])["query"].String() != query {
+		t.Errorf("InQuery ran %v, want the query %q", records, query)
+	}
+}
+
+func TestSelectUsersByIDsChunks(t *testing.T) {
+	db := newTestDB(t)
+	insertUsers(t, db, 1200)
+	ids := make([]int, 1200)
+	for i := range ids {
+		ids[i] = i + 1
+	}
+
+	before := Metrics()
+	users, err := SelectUsersByIDs(context.Background(), db, ids)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 500, 500, 200 の 3 回に分かれる
+	if got := Metrics().QueriesTotal - before.QueriesTotal; got != 3 {
+		t.Errorf("queries = %d, want 3", got)
+	}
+	if len(users) != len(ids) {
+		t.Errorf("len(users) = %d, want %d", len(users), len(ids))
+	}
+}
+
+func TestNullPostToPost(t *testing.T) {
+	t.Run("non-NULL", func(t *testing.T) {
+		n := nullPost{
+			PostID:      sql.Null[int]{V: 1, Valid: true},
+			PostContent: sql.Null[string]{V: "Hello, Alice", Valid: true},
+			PostStatus:  sql.Null[PostStatus]{V: PostStatusDraft, Valid: true},
+		}
+		p, ok := n.toPost(1)
+		if !ok {
+			t.Fatal("toPost returned false")
+		}
+		if p.ID != 1 || p.UserID != 1 || p.Content != "Hello, Alice" || p.Status != PostStatusDraft {
+			t.Errorf("toPost = %+v", p)
+		}
+	})
+	t.Run("NULL", func(t *testing.T) {
+		// LEFT JOIN で posts がない行
+		if p, ok := (nullPost{}).toPost(3); ok {
+			t.Errorf("toPost = %+v, true, want false", p)
+		}
+	})
+}
+
+// 書き込まれたログに want が現れたら found を閉じる
+type logWatcher struct {
+	mu    sync.Mutex
+	buf   strings.Builder
+	want  string
+	found chan struct{}
+}
+
+func (w *logWatcher) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf.Write(p)
+	if w.found != nil && strings.Contains(w.buf.String(), w.want) {
+		close(w.found)
+		w.found = nil
+	}
+	return len(p), nil
+}
+
+// Run を別の goroutine で動かし, デモが終わってシグナル待ちになるまで待つ
+func startRun(t *testing.T, ctx context.Context) (<-chan error, *sqlx.DB) {
+	t.Helper()
+	found := make(chan struct{})
+	w := &logWatcher{want: "Waiting for a signal", found: found}
+	log.SetOutput(w)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	var db *sqlx.DB
+	path := filepath.Join(t.TempDir(), "test.db")
+	old := openDB
+	openDB = func() (*sqlx.DB, error) {
+		var err error
+		db, err = InitDB("sqlite3", path)
+		return db, err
+	}
+	t.Cleanup(func() { openDB = old })
+
+	done := make(chan error, 1)
+	go func() { done <- Run(ctx) }()
+	select {
+	case <-found:
+	case err := <-done:
+		t.Fatalf("Run returned before waiting: %v", err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("Run did not reach the shutdown wait")
+	}
+	return done, db
+}
+
+// Run が nil を返し, DB が閉じられていることを確かめる
+func waitRun(t *testing.T, done <-chan error, db *sqlx.DB) {
+	t.Helper()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Run did not return")
+	}
+	if err := db.Ping(); err == nil {
+		t.Error("DB is still open after Run returned")
+	}
+}
+
+func TestRunShutsDownOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done, db := startRun(t, ctx)
+	cancel()
+	waitRun(t, done, db)
+}
+
+func TestRunShutsDownOnSignal(t *testing.T) {
+	done, db := startRun(t, context.Background())
+	// シグナル待ちの間は Run が SIGINT を受け取るので, テストのプロセスは終了しない
+	if err := syscall.Kill(os.Getpid(), syscall.SIGINT); err != nil {
+		t.Fatal(err)
+	}
+	waitRun(t, done, db)
+}
+
+func TestInsertPostsForUser(t *testing.T) {
+	db := newSeededTestDB(t)
+	ctx := context.Background()
+
+	if err := InsertPostsForUser(ctx, db, 3, []string{"Hello, Charlie"}); err != nil {
+		t.Fatal(err)
+	}
+	posts, err := PostsByUser(ctx, db, []int{3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(posts[3]) != 1 || posts[3][0].Content != "Hello, Charlie" {
+		t.Errorf("Charlie's posts = %+v, want [Hello, Charlie]", posts[3])
+	}
+
+	if err := InsertPostsForUser(ctx, db, 999, []string{"Hello, nobody"}); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("InsertPostsForUser(999) error = %v, want ErrUserNotFound", err)
+	}
+}
+
+func TestUserValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		user    User
+		wantErr bool
+	}{
+		{"empty", User{Name: " "}, true},
+		{"too long", User{Name: strings.Repeat("あ", MaxUserNameLength+1)}, true},
+		{"valid", User{Name: strings.Repeat("あ", MaxUserNameLength)}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.user.Validate()
+			if tt.wantErr != errors.Is(err, ErrInvalidUser) {
+				t.Errorf("Validate() = %v, want error: %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	// 挿入する関数は DB に触る前に弾く
+	db := newTestDB(t)
+	if _, err := CreateUser(context.Background(), db, ""); !errors.Is(err, ErrInvalidUser) {
+		t.Errorf("CreateUser(\"\") error = %v, want ErrInvalidUser", err)
+	}
+}
+
+func TestReplaceUserPosts(t *testing.T) {
+	db := newSeededTestDB(t)
+	ctx := context.Background()
+
+	if err := ReplaceUserPosts(ctx, db, 1, []Post{{Content: "Replaced"}}); err != nil {
+		t.Fatal(err)
+	}
+	posts, err := PostsByUser(ctx, db, []int{1, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(posts[1]) != 1 || posts[1][0].Content != "Replaced" {
+		t.Errorf("Alice's posts = %+v, want [Replaced]", posts[1])
+	}
+	if len(posts[2]) != 1 {
+		t.Errorf("Bob's posts = %+v, want unchanged", posts[2])
+	}
+}
+
+func TestBulkInsertIgnoreExistingRerun(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	users := []User{{Name: "Alice"}, {Name: "Bob"}}
+	posts := []Post{{UserID: 1, Content: "Hello, Alice"}, {UserID: 2, Content: "Hello, Bob"}}
+
+	for i := range 2 {
+		if _, _, err := BulkInsertIgnoreExisting(ctx, db, users, posts); err != nil {
+			t.Fatalf("run %d: %v", i+1, err)
+		}
+		var counts struct {
+			Users int `db:"users"`
+			Posts int `db:"posts"`
+		}
+		if err := db.Get(&counts, "SELECT (SELECT COUNT(*) FROM users) AS users, (SELECT COUNT(*) FROM posts) AS posts"); err != nil {
+			t.Fatal(err)
+		}
+		if counts.Users != 2 || counts.Posts != 2 {
+			t.Errorf("run %d: users = %d, posts = %d, want 2 and 2", i+1, counts.Users, counts.Posts)
+		}
+	}
+}
+
+func TestPostCountsByUser(t *testing.T) {
+	db := newSeededTestDB(t)
+
+	counts, err := PostCountsByUser(context.Background(), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[int]int{1: 2, 2: 1}; !maps.Equal(counts, want) {
+		t.Errorf("PostCountsByUser = %v, want %v", counts, want)
+	}
+	if _, ok := counts[3]; ok {
+		t.Error("user 3 without posts has a count")
+	}
+}
+
+func TestStreamUsersStopsEarly(t *testing.T) {
+	db := newSeededTestDB(t)
+	ctx := context.Background()
+	errStop := errors.New("stop")
+
+	calls := 0
+	err := StreamUsers(ctx, db, func(u User) error {
+		calls++
+		return errStop
+	})
+	if !errors.Is(err, errStop) {
+		t.Errorf("StreamUsers error = %v, want %v", err, errStop)
+	}
+	if calls != 1 {
+		t.Errorf("fn called %d times, want 1", calls)
+	}
+	// 接続は 1 つだけなので, rows が閉じられていなければここで待ち続ける
+	if _, err := CountUsers(ctx, db); err != nil {
+		t.Errorf("CountUsers after stopping the stream: %v", err)
+	}
+}
+
+func TestSelectUsersByNames(t *testing.T) {
+	db := newSeededTestDB(t)
+	ctx := context.Background()
+
+	users, err := SelectUsersByNames(ctx, db, []string{"Alice", "Charlie"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := userNames(users), []string{"Alice", "Charlie"}; !slices.Equal(got, want) {
+		t.Errorf("SelectUsersByNames = %v, want %v", got, want)
+	}
+
+	users, err = SelectUsersByNames(ctx, db, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 0 {
+		t.Errorf("SelectUsersByNames(nil) = %v, want empty", users)
+	}
+}
+
+func TestInitDBUnknownDriver(t *testing.T) {
+	if _, err := InitDB("bogus", "whatever"); err == nil {
+		t.Error("InitDB with an unknown driver returned no error")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("MustInitDB with an unknown driver did not panic")
+		}
+	}()
+	MustInitDB("bogus", "whatever")
+}
+
+func TestBulkInsertUsersCollect(t *testing.T) {
+	for _, inTx := range []bool{false, true} {
+		t.Run(fmt.Sprintf("inTx=%v", inTx), func(t *testing.T) {
+			db := newTestDB(t)
+			ctx := context.Background()
+
+			users := []User{{Name: "Alice"}, {Name: "Alice"}, {Name: "Bob"}}
+			inserted, errs := BulkInsertUsersCollect(ctx, db, users, inTx)
+			for i, wantErr := range []bool{false, true, false} {
+				var conflict *ConflictError
+				if got := errors.As(errs[i], &conflict); got != wantErr {
+					t.Errorf("errs[%d] = %v, want conflict: %v", i, errs[i], wantErr)
+				}
+				if (inserted[i].ID == 0) != wantErr {
+					t.Errorf("inserted[%d].ID = %d", i, inserted[i].ID)
+				}
+			}
+			if errs[1] != nil && !strings.Contains(errs[1].Error(), "[1]") {
+				t.Errorf("errs[1] = %q, want the index of the failed row", errs[1])
+			}
+
+			users2, err := SelectUsers(ctx, db)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := userNames(users2), []string{"Alice", "Bob"}; !slices.Equal(got, want) {
+				t.Errorf("SelectUsers = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestRecentPosts(t *testing.T) {
+	// Seed の 3 件は同じ created_at なので id の大きい順になる
+	db := newSeededTestDB(t)
+	ctx := context.Background()
+	time.Sleep(10 * time.Millisecond)
+	if _, _, err := BulkInsert(ctx, db, nil, []Post{{UserID: 3, Content: "Hello, Charlie"}}); err != nil {
+		t.Fatal(err)
+	}
+	// created_at が新しければ id が小さくても先に来る
+	if _, err := db.Exec("UPDATE posts SET created_at = ? WHERE id = 1", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	postIDs := func(posts []Post) []int {
+		ids := make([]int, len(posts))
+		for i, p := range posts {
+			ids[i] = p.ID
+		}
+		return ids
+	}
+	posts, err := RecentPosts(ctx, db, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := postIDs(posts), []int{1, 4, 3, 2}; !slices.Equal(got, want) {
+		t.Errorf("RecentPosts(0) = %v, want %v", got, want)
+	}
+	posts, err = RecentPosts(ctx, db, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := postIDs(posts), []int{1, 4}; !slices.Equal(got, want) {
+		t.Errorf("RecentPosts(2) = %v, want %v", got, want)
+	}
+}
+
+func TestDeleteUsersByIDs(t *testing.T) {
+	db := newSeededTestDB(t)
+	ctx := context.Background()
+
+	n, err := DeleteUsersByIDs(ctx, db, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Errorf("DeleteUsersByIDs(nil) = %d, want 0", n)
+	}
+
+	n, err = DeleteUsersByIDs(ctx, db, []int{1, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("DeleteUsersByIDs = %d, want 2", n)
+	}
+	users, err := SelectUsers(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := userNames(users), []string{"Bob"}; !slices.Equal(got, want) {
+		t.Errorf("SelectUsers = %v, want %v", got, want)
+	}
+}
+
+func TestUsersWithAnyPost(t *testing.T) {
+	db := newSeededTestDB(t)
+
+	users, err := UsersWithAnyPost(context.Background(), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Alice は 2 件の posts を持つが 1 回だけ, posts のない Charlie は含まない
+	if got, want := userIDs(users), []int{1, 2}; !slices.Equal(got, want) {
+		t.Errorf("UsersWithAnyPost ids = %v, want %v", got, want)
+	}
+}
+
+func TestUserPostRowToPost(t *testing.T) {
+	db := newSeededTestDB(t)
+
+	rows, err := selectUserPostRows(context.Background(), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Alice の 1 件目と, posts のない Charlie の行
+	valid, null := rows[0], rows[len(rows)-1]
+
+	p, ok := valid.ToPost()
+	if !ok {
+		t.Fatal("ToPost of Alice's row returned false")
+	}
+	if p.ID != 1 || p.UserID != 1 || p.Content != "Hello, Alice" || p.Status != PostStatusPublished || p.CreatedAt.IsZero() {
+		t.Errorf("ToPost = %+v", p)
+	}
+	if null.UserID != 3 {
+		t.Fatalf("last row user_id = %d, want 3", null.UserID)
+	}
+	if p, ok := null.ToPost(); ok {
+		t.Errorf("ToPost of Charlie's row = %+v, true, want false", p)
+	}
+}
+
+func TestBulkInsertMultiValues(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+
+	// 1 回の INSERT に入る件数 (inQueryChunkSize / 3) を超えるようにする
+	users := make([]User, 1200)
+	for i := range users {
+		users[i] = User{Name: fmt.Sprintf("user%d", i+1)}
+	}
+	n, err := BulkInsertMultiValues(ctx, db, users)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(users)) {
+		t.Errorf("BulkInsertMultiValues = %d, want %d", n, len(users))
+	}
+	got, err := SelectUsers(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(users) || got[0].Name != "user1" || got[len(got)-1].Name != "user1200" {
+		t.Errorf("SelectUsers returned %d users, want %d in order", len(got), len(users))
+	}
+	if got[0].CreatedAt.IsZero() {
+		t.Error("CreatedAt is zero")
+	}
+}
+
+func benchmarkBulkInsert(b *testing.B, insert func(context.Context, *sqlx.DB, []User) error) {
+	db := newTestDB(b)
+	ctx := context.Background()
+	const size = 1000
+
+	b.ResetTimer()
+	for i := range b.N {
+		// name は UNIQUE なので回ごとに変える
+		b.StopTimer()
+		users := make([]User, size)
+		for j := range users {
+			users[j] = User{Name: fmt.Sprintf("user%d-%d", i, j)}
+		}
+		b.StartTimer()
+		if err := insert(ctx, db, users); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkBulkInsertMultiValues(b *testing.B) {
+	benchmarkBulkInsert(b, func(ctx context.Context, db *sqlx.DB, users []User) error {
+		_, err := BulkInsertMultiValues(ctx, db, users)
+		return err
+	})
+}
+
+// BulkInsert の users と同じく, スライスを NamedExec に渡して 1 つの INSERT にする
+func BenchmarkBulkInsertNamedExec(b *testing.B) {
+	benchmarkBulkInsert(b, func(ctx context.Context, db *sqlx.DB, users []User) error {
+		now := time.Now()
+		for i := range users {
+			users[i].CreatedAt, users[i].UpdatedAt = now, now
+		}
+		_, err := namedExecContext(ctx, db, insertUsersQuery, users)
+		return err
+	})
+}
+
+func TestUpdateUserFields(t *testing.T) {
+	db := newSeededTestDB(t)
+	ctx := context.Background()
+
+	if err := UpdateUserFields(ctx, db, 1, map[string]any{"name": "Alicia"}); err != nil {
+		t.Fatal(err)
+	}
+	user, err := GetUserByID(ctx, db, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Name != "Alicia" {
+		t.Errorf("Name = %q, want %q", user.Name, "Alicia")
+	}
+	if !user.UpdatedAt.After(user.CreatedAt) {
+		t.Errorf("UpdatedAt = %v, want after CreatedAt %v", user.UpdatedAt, user.CreatedAt)
+	}
+
+	if err := UpdateUserFields(ctx, db, 1, map[string]any{"email": "alice@example.com"}); err == nil {
+		t.Error("UpdateUserFields accepted the unknown field \"email\"")
+	}
+	for _, name := range []any{" ", 42} {
+		if err := UpdateUserFields(ctx, db, 1, map[string]any{"name": name}); !errors.Is(err, ErrInvalidUser) {
+			t.Errorf("UpdateUserFields with name %#v error = %v, want ErrInvalidUser", name, err)
+		}
+	}
+	if err := UpdateUserFields(ctx, db, 999, map[string]any{"name": "Nobody"}); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("UpdateUserFields(999) error = %v, want ErrUserNotFound", err)
+	}
+}
+
+func TestSelectUsersMap(t *testing.T) {
+	db := newSeededTestDB(t)
+
+	users, err := SelectUsersMap(context.Background(), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 3 {
+		t.Errorf("len = %d, want 3", len(users))
+	}
+	if users[1].Name != "Alice" {
+		t.Errorf("users[1].Name = %q, want %q", users[1].Name, "Alice")
+	}
+}
+
+func TestGetOrCreateUser(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+
+	first, created, err := GetOrCreateUser(ctx, db, "Dave")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !created {
+		t.Error("first call: created = false, want true")
+	}
+	second, created, err := GetOrCreateUser(ctx, db, "Dave")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created {
+		t.Error("second call: created = true, want false")
+	}
+	if second.ID != first.ID {
+		t.Errorf("second call id = %d, want %d", second.ID, first.ID)
+	}
+}
+
+func TestSelectUsersWithExtraColumn(t *testing.T) {
+	db := newSeededTestDB(t)
+
+	// 構造体にないカラムがあっても, SELECT するカラムを並べているので Scan できる
+	if _, err := db.Exec("ALTER TABLE users ADD COLUMN email TEXT"); err != nil {
+		t.Fatal(err)
+	}
+	users, err := SelectUsers(context.Background(), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 3 {
+		t.Errorf("SelectUsers = %v, want 3 users", users)
+	}
+}
+
+func TestPostsWithAuthors(t *testing.T) {
+	db := newSeededTestDB(t)
+
+	posts, err := PostsWithAuthors(context.Background(), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(posts) != 3 {
+		t.Fatalf("len(posts) = %d, want 3", len(posts))
+	}
+	authors := map[string]string{}
+	for _, p := range posts {
+		authors[p.Content] = p.AuthorName
+	}
+	if got := authors["Hello, Alice"]; got != "Alice" {
+		t.Errorf("AuthorName of \"Hello, Alice\" = %q, want %q", got, "Alice")
+	}
+}
+
+func TestSelectUsersInNamed(t *testing.T) {
+	var queries []string
+	db := NewObservedDB(newSeededTestDB(t), func(query string, _ time.Duration, _ error) {
+		queries = append(queries, query)
+	})
+	ctx := context.Background()
+
+	users, err := SelectUsersInNamed(ctx, db, []int{3, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := userNames(users), []string{"Alice", "Charlie"}; !slices.Equal(got, want) {
+		t.Errorf("SelectUsersInNamed = %v, want %v", got, want)
+	}
+	if len(queries) != 1 {
+		t.Fatalf("queries = %v, want 1", queries)
+	}
+	if !strings.Contains(queries[0], "id IN (?, ?)") || strings.Contains(queries[0], ":ids") {
+		t.Errorf("query = %q, want :ids expanded to 2 placeholders", queries[0])
+	}
+
+	users, err = SelectUsersInNamed(ctx, db, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 0 {
+		t.Errorf("SelectUsersInNamed(nil) = %v, want empty", users)
+	}
+}
+
+func TestSelectUsersLenientNullName(t *testing.T) {
+	db, err := InitDB("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	// マイグレーションの users は name が NOT NULL なので, 制約のないテーブルで NULL を作る
+	schema := `
+		CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT, created_at DATETIME, updated_at DATETIME, deleted_at DATETIME);
+		INSERT INTO users (name, created_at, updated_at) VALUES ('Alice', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP), (NULL, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP);
+	`
+	ctx := context.Background()
+	if _, err := db.ExecContext(ctx, schema); err != nil {
+		t.Fatal(err)
+	}
+
+	users, err := SelectUsersLenient(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 2 {
+		t.Fatalf("len(users) = %d, want 2", len(users))
+	}
+	if users[0].Name != "Alice" || users[0].NameIsNull {
+		t.Errorf("users[0] = %+v, want Alice", users[0])
+	}
+	if users[1].Name != "" || !users[1].NameIsNull {
+		t.Errorf("users[1] = %+v, want a NULL name", users[1])
+	}
+
+	// string には NULL を Scan できないので, 厳密な方はエラーになる
+	if _, err := SelectUsers(ctx, db); err == nil {
+		t.Error("SelectUsers scanned a NULL name without error")
+	}
+}
+
+func TestDeleteCascadesToPosts(t *testing.T) {
+	db := newSeededTestDB(t)
+
+	// posts には触らずに users だけを消す
+	if _, err := db.Exec("DELETE FROM users WHERE id = 1"); err != nil {
+		t.Fatal(err)
+	}
+	var owners []int
+	if err := db.Select(&owners, "SELECT user_id FROM posts ORDER BY id"); err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{2}; !slices.Equal(owners, want) {
+		t.Errorf("posts.user_id = %v, want %v", owners, want)
+	}
+}
+
+func TestFirstAndLastUser(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("populated", func(t *testing.T) {
+		db := newSeededTestDB(t)
+		first, err := FirstUser(ctx, db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		last, err := LastUser(ctx, db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if first.Name != "Alice" || last.Name != "Charlie" {
+			t.Errorf("FirstUser, LastUser = %s, %s, want Alice, Charlie", first.Name, last.Name)
+		}
+	})
+	t.Run("empty", func(t *testing.T) {
+		db := newTestDB(t)
+		if _, err := FirstUser(ctx, db); !errors.Is(err, ErrUserNotFound) {
+			t.Errorf("FirstUser error = %v, want ErrUserNotFound", err)
+		}
+		if _, err := LastUser(ctx, db); !errors.Is(err, ErrUserNotFound) {
+			t.Errorf("LastUser error = %v, want ErrUserNotFound", err)
+		}
+	})
+}
+
+func TestBulkInsertEmpty(t *testing.T) {
+	db := newTestDB(t)
+
+	before := Metrics()
+	users, posts, err := BulkInsert(context.Background(), db, []User{}, []Post{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if users != 0 || posts != 0 {
+		t.Errorf("BulkInsert = %d, %d, want 0, 0", users, posts)
+	}
+	if after := Metrics(); after.QueriesTotal != before.QueriesTotal {
+		t.Errorf("BulkInsert ran %d queries, want none", after.QueriesTotal-before.QueriesTotal)
+	}
+}
+
+func TestSelectUserNames(t *testing.T) {
+	db := newSeededTestDB(t)
+
+	names, err := SelectUserNames(context.Background(), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"Alice", "Bob", "Charlie"}; !slices.Equal(names, want) {
+		t.Errorf("SelectUserNames = %v, want %v", names, want)
+	}
+}
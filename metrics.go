@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync/atomic"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// 外部ライブラリに依存しないクエリ数のカウンタ
+type metricsCounters struct {
+	QueriesTotal atomic.Int64
+	ErrorsTotal  atomic.Int64
+}
+
+var metrics metricsCounters
+
+type MetricsSnapshot struct {
+	QueriesTotal int64
+	ErrorsTotal  int64
+}
+
+func Metrics() MetricsSnapshot {
+	return MetricsSnapshot{
+		QueriesTotal: metrics.QueriesTotal.Load(),
+		ErrorsTotal:  metrics.ErrorsTotal.Load(),
+	}
+}
+
+// 該当行がないのは失敗ではないので sql.ErrNoRows はエラーに数えない
+func recordQuery(err error) {
+	metrics.QueriesTotal.Add(1)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		metrics.ErrorsTotal.Add(1)
+	}
+}
+
+// 以下は sqlx の関数を呼んでカウンタを更新するだけ
+// DB にアクセスする関数はこれらを経由する
+// クエリの {users} などはここでテーブル名に置き換える (expandTables)
+// プレースホルダも ? で書いておけば, ここでドライバに合わせて書き換える (q)
+// 結果を読み切って返すものは, ここで 1 クエリごとに DefaultQueryTimeout を掛ける (withTimeout)
+// 呼び出し側の関数では掛けない. 複数のクエリやリトライの待ち時間まで 1 つのタイムアウトに含まれてしまう
+// rows を返すものは呼び出し元が読み終わるまで ctx を生かしておく必要があるので掛けない
+
+// *sqlx.DB, *sqlx.Tx と, それらを埋め込んだラッパーが満たす
+type rebinder interface {
+	Rebind(query string) string
+}
+
+// テーブル名を展開して, db が Rebind を持っていればプレースホルダを書き換える
+// Postgres の $1 などに書き換え済みのクエリには ? が残っていないので, 2 回通しても変わらない
+func q(db any, query string) string {
+	query = expandTables(query)
+	if r, ok := db.(rebinder); ok {
+		query = r.Rebind(query)
+	}
+	return query
+}
+
+func selectContext(ctx context.Context, db sqlx.QueryerContext, dest any, query string, args ...any) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	err := sqlx.SelectContext(ctx, db, dest, q(db, query), args...)
+	recordQuery(err)
+	return err
+}
+
+func getContext(ctx context.Context, db sqlx.QueryerContext, dest any, query string, args ...any) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	err := sqlx.GetContext(ctx, db, dest, q(db, query), args...)
+	recordQuery(err)
+	return err
+}
+
+func execContext(ctx context.Context, e sqlx.ExecerContext, query string, args ...any) (sql.Result, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	result, err := e.ExecContext(ctx, q(e, query), args...)
+	recordQuery(err)
+	return result, err
+}
+
+// 名前付きのものは sqlx がドライバのプレースホルダに書き換えるので, テーブル名だけ展開する
+func namedExecContext(ctx context.Context, e sqlx.ExtContext, query string, arg any) (sql.Result, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	result, err := sqlx.NamedExecContext(ctx, e, expandTables(query), arg)
+	recordQuery(err)
+	return result, err
+}
+
+func queryxContext(ctx context.Context, db sqlx.QueryerContext, query string, args ...any) (*sqlx.Rows, error) {
+	rows, err := db.QueryxContext(ctx, q(db, query), args...)
+	recordQuery(err)
+	return rows, err
+}
+
+func namedQueryContext(ctx context.Context, e sqlx.ExtContext, query string, arg any) (*sqlx.Rows, error) {
+	rows, err := sqlx.NamedQueryContext(ctx, e, expandTables(query), arg)
+	recordQuery(err)
+	return rows, err
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func TestMetrics(t *testing.T) {
+	db := newSeededTestDB(t)
+	ctx := context.Background()
+
+	// カウンタはパッケージ全体で共有しているので差分で確かめる
+	before := Metrics()
+	for range 3 {
+		if _, err := SelectUsers(ctx, db); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := SelectAll[User](ctx, db, "SELECT * FROM no_such_table"); err == nil {
+		t.Fatal("query on a missing table returned no error")
+	}
+	after := Metrics()
+
+	if got := after.QueriesTotal - before.QueriesTotal; got != 4 {
+		t.Errorf("QueriesTotal delta = %d, want 4", got)
+	}
+	if got := after.ErrorsTotal - before.ErrorsTotal; got != 1 {
+		t.Errorf("ErrorsTotal delta = %d, want 1", got)
+	}
+}
+
+// DB にアクセスするヘルパーは全て q を通すので, ? で書いたクエリがドライバのプレースホルダになる
+func TestRebind(t *testing.T) {
+	db := newTestDB(t)
+	// 実際には接続しないので, ドライバ名だけ Postgres にする
+	pg := sqlx.NewDb(db.DB, "postgres")
+	query := "SELECT id FROM {users} WHERE id = ? AND name = ?"
+
+	if got, want := q(pg, query), "SELECT id FROM users WHERE id = $1 AND name = $2"; got != want {
+		t.Errorf("q(postgres) = %q, want %q", got, want)
+	}
+	if got, want := q(db, query), "SELECT id FROM users WHERE id = ? AND name = ?"; got != want {
+		t.Errorf("q(sqlite3) = %q, want %q", got, want)
+	}
+	// 書き換え済みのクエリはもう一度通しても変わらない
+	if got := q(pg, q(pg, query)); got != q(pg, query) {
+		t.Errorf("q twice = %q", got)
+	}
+}
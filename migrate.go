@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/samber/lo"
+)
+
+// Version は 1 から始めて, 適用済みのものは書き換えずに新しい Version を足していく
+type Migration struct {
+	Version int
+	SQL     string
+}
+
+// アプリのテーブル定義
+// DDL のうち DB ごとに違う部分は Dialect で埋める
+func SchemaMigrations(d Dialect) []Migration {
+	return []Migration{
+		{
+			Version: 1,
+			SQL: fmt.Sprintf(`
+				CREATE TABLE {users} (
+					id %[1]s,
+					name TEXT NOT NULL UNIQUE,
+					created_at %[2]s NOT NULL,
+					updated_at %[2]s NOT NULL,
+					deleted_at %[2]s
+				);
+
+				CREATE TABLE {posts} (
+					id %[1]s,
+					user_id INTEGER NOT NULL,
+					content TEXT NOT NULL,
+					created_at %[2]s NOT NULL,
+					updated_at %[2]s NOT NULL,
+					FOREIGN KEY (user_id) REFERENCES {users}(id)
+				);
+			`, d.AutoIncrementPrimaryKey, d.DateTime),
+		},
+		{
+			Version: 2,
+			SQL: `
+				ALTER TABLE {posts} ADD COLUMN status TEXT NOT NULL DEFAULT 'draft'
+					CHECK (status IN ('draft', 'published', 'archived'));
+			`,
+		},
+		{
+			// UpsertPost で (user_id, content) を自然キーとして使う
+			// 既に重複した posts があると失敗するので, 先に片付けておくこと
+			Version: 3,
+			SQL: `
+				CREATE UNIQUE INDEX {posts}_user_id_content_key ON {posts} (user_id, content);
+			`,
+		},
+		{
+			// IncrementCounter で使う名前付きのカウンタ
+			Version: 4,
+			SQL: `
+				CREATE TABLE {counters} (
+					name TEXT PRIMARY KEY,
+					value INTEGER NOT NULL
+				);
+			`,
+		},
+		{
+			Version: 5,
+			SQL: `
+				ALTER TABLE {posts} ADD COLUMN metadata TEXT;
+			`,
+		},
+		{
+			// user を消したらその posts も消えるようにする
+			// SQLite は接続ごとに foreign_keys を有効にしないと効かない (SQLiteDSN を参照)
+			Version: 6,
+			SQL:     cascadePostsUserID(d),
+		},
+	}
+}
+
+func cascadePostsUserID(d Dialect) string {
+	if d.AlterConstraint {
+		return `
+			ALTER TABLE {posts}
+				DROP CONSTRAINT {posts}_user_id_fkey,
+				ADD CONSTRAINT {posts}_user_id_fkey FOREIGN KEY (user_id) REFERENCES {users}(id) ON DELETE CASCADE;
+		`
+	}
+	// 作り直すテーブルは version 1 から 5 までを適用した posts と同じ定義にする
+	// DROP するとインデックスも消えるので作り直す
+	return fmt.Sprintf(`
+		CREATE TABLE {posts}_new (
+			id %[1]s,
+			user_id INTEGER NOT NULL,
+			content TEXT NOT NULL,
+			created_at %[2]s NOT NULL,
+			updated_at %[2]s NOT NULL,
+			status TEXT NOT NULL DEFAULT 'draft'
+				CHECK (status IN ('draft', 'published', 'archived')),
+			metadata TEXT,
+			FOREIGN KEY (user_id) REFERENCES {users}(id) ON DELETE CASCADE
+		);
+		INSERT INTO {posts}_new (id, user_id, content, created_at, updated_at, status, metadata)
+			SELECT id, user_id, content, created_at, updated_at, status, metadata FROM {posts};
+		DROP TABLE {posts};
+		ALTER TABLE {posts}_new RENAME TO {posts};
+		CREATE UNIQUE INDEX {posts}_user_id_content_key ON {posts} (user_id, content);
+	`, d.AutoIncrementPrimaryKey, d.DateTime)
+}
+
+// schema_migrations に記録された最大の Version より新しいものだけを, Version 順に適用する
+// 1 つのマイグレーションとその記録は同じトランザクションで行うので, 途中で失敗してもその Version だけロールバックされる
+func Migrate(ctx context.Context, db *sqlx.DB, migrations []Migration) error {
+	if _, err := execContext(ctx, db, "CREATE TABLE IF NOT EXISTS {schema_migrations} (version INTEGER PRIMARY KEY)"); err != nil {
+		return fmt.Errorf("Migrate.init: %w", err)
+	}
+	current, err := SchemaVersion(ctx, db)
+	if err != nil {
+		return fmt.Errorf("Migrate: %w", err)
+	}
+
+	// 呼び出し元のスライスは並べ替えない
+	migrations = slices.Clone(migrations)
+	slices.SortFunc(migrations, func(a, b Migration) int { return a.Version - b.Version })
+	for _, m := range migrations {
+		if m.Version <= current {
+			continue
+		}
+		err := WithTx(ctx, db, func(tx *sqlx.Tx) error {
+			if err := execStatements(ctx, tx, m.SQL); err != nil {
+				return err
+			}
+			_, err := execContext(ctx, tx, "INSERT INTO {schema_migrations} (version) VALUES (?)", m.Version)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("Migrate: version %d: %w", m.Version, err)
+		}
+	}
+	return nil
+}
+
+// 1 つも適用していなければ 0
+func SchemaVersion(ctx context.Context, db sqlx.QueryerContext) (int, error) {
+	version, err := SelectOne[int](ctx, db, "SELECT COALESCE(MAX(version), 0) FROM {schema_migrations}")
+	if err != nil {
+		return 0, fmt.Errorf("SchemaVersion: %w", err)
+	}
+	return version, nil
+}
+
+// 全テーブルを消す. データが入っている DB に対して実行すると全部消える
+// 外部キー制約が有効なので参照する側の posts から DROP する
+func ResetSchema(ctx context.Context, db sqlx.ExecerContext) error {
+	schema := `
+		DROP TABLE IF EXISTS {counters};
+		DROP TABLE IF EXISTS {posts};
+		DROP TABLE IF EXISTS {users};
+		DROP TABLE IF EXISTS {schema_migrations};
+	`
+	if err := execStatements(ctx, db, schema); err != nil {
+		return fmt.Errorf("ResetSchema: %w", err)
+	}
+	return nil
+}
+
+// 1 回の Exec で複数の文を実行できないドライバがあるので, ; で区切って 1 文ずつ実行する
+// 引用符 (' と ") と -- から行末までのコメントの中の ; では区切らない. Postgres の $$ などの引用には対応していない
+func execStatements(ctx context.Context, db sqlx.ExecerContext, query string) error {
+	for _, stmt := range splitStatements(query) {
+		if _, err := execContext(ctx, db, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 空白しかない文は含めない
+// 引用符の中の引用符は 2 つ重ねて書くので, 閉じて開き直したのと同じに扱えばいい
+func splitStatements(query string) []string {
+	var stmts []string
+	var quote rune
+	var comment bool
+	start := 0
+	for i, r := range query {
+		switch {
+		case comment:
+			if r == '\n' {
+				comment = false
+			}
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case strings.HasPrefix(query[i:], "--"):
+			comment = true
+		case r == '\'' || r == '"':
+			quote = r
+		case r == ';':
+			stmts = append(stmts, query[start:i])
+			start = i + 1
+		}
+	}
+	stmts = append(stmts, query[start:])
+	return lo.Filter(lo.Map(stmts, func(s string, _ int) string {
+		return strings.TrimSpace(s)
+	}), func(s string, _ int) bool {
+		return s != ""
+	})
+}
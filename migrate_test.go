@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestMigrateIdempotent(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+
+	// newTestDB で 1 回適用済み
+	if err := Migrate(ctx, db, SchemaMigrations(DialectFor(db.DriverName()))); err != nil {
+		t.Fatalf("second Migrate: %v", err)
+	}
+	insertUsers(t, db, 1)
+}
+
+func TestMigrateSkipsApplied(t *testing.T) {
+	db, err := InitDB("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	ctx := context.Background()
+
+	// IF NOT EXISTS を付けないので, もう一度適用されるとエラーになる
+	migrations := []Migration{
+		{Version: 1, SQL: "CREATE TABLE a (id INTEGER PRIMARY KEY)"},
+		{Version: 2, SQL: "CREATE TABLE b (id INTEGER PRIMARY KEY)"},
+	}
+	for i := range 2 {
+		if err := Migrate(ctx, db, migrations); err != nil {
+			t.Fatalf("run %d: %v", i+1, err)
+		}
+	}
+
+	version, err := SchemaVersion(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != 2 {
+		t.Errorf("SchemaVersion = %d, want 2", version)
+	}
+	var applied int
+	if err := db.Get(&applied, "SELECT COUNT(*) FROM schema_migrations"); err != nil {
+		t.Fatal(err)
+	}
+	if applied != 2 {
+		t.Errorf("schema_migrations has %d rows, want 2", applied)
+	}
+}
+
+func TestExecStatements(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+
+	// 引用符の中の ; では区切らない
+	query := `
+		INSERT INTO users (name, created_at, updated_at) VALUES ('Alice; Bob', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP);
+		INSERT INTO users (name, created_at, updated_at) VALUES ('Charlie', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP);
+	`
+	if got := len(splitStatements(query)); got != 2 {
+		t.Errorf("splitStatements returned %d statements, want 2", got)
+	}
+	if err := execStatements(ctx, db, query); err != nil {
+		t.Fatal(err)
+	}
+
+	// コメントの中の ' は引用符として扱わない
+	query = `
+		-- don't split here; the users below are separate
+		INSERT INTO users (name, created_at, updated_at) VALUES ('Dave', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP);
+		INSERT INTO users (name, created_at, updated_at) VALUES ('Eve', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP);
+	`
+	if got := len(splitStatements(query)); got != 2 {
+		t.Errorf("splitStatements with a comment returned %d statements, want 2", got)
+	}
+	if err := execStatements(ctx, db, query); err != nil {
+		t.Fatal(err)
+	}
+	users, err := SelectUsers(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := userNames(users), []string{"Alice; Bob", "Charlie", "Dave", "Eve"}; !slices.Equal(got, want) {
+		t.Errorf("SelectUsers = %v, want %v", got, want)
+	}
+}
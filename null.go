@@ -0,0 +1,22 @@
+package main
+
+import "database/sql"
+
+// NULL ならゼロ値を返す
+// sql.Null の V は NULL を Scan したときゼロ値になるが, 自分で組み立てた値だとそうとは限らないので Valid を見る
+func NullToZero[T any](n sql.Null[T]) T {
+	if !n.Valid {
+		var zero T
+		return zero
+	}
+	return n.V
+}
+
+// NULL なら nil を返す
+func NullToPtr[T any](n sql.Null[T]) *T {
+	if !n.Valid {
+		return nil
+	}
+	v := n.V
+	return &v
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestNullToZero(t *testing.T) {
+	if got := NullToZero(sql.Null[int]{V: 42, Valid: true}); got != 42 {
+		t.Errorf("NullToZero(valid int) = %d, want 42", got)
+	}
+	// Valid でなければ V に値が入っていてもゼロ値にする
+	if got := NullToZero(sql.Null[int]{V: 42}); got != 0 {
+		t.Errorf("NullToZero(invalid int) = %d, want 0", got)
+	}
+	if got := NullToZero(sql.Null[string]{V: "Alice", Valid: true}); got != "Alice" {
+		t.Errorf("NullToZero(valid string) = %q, want %q", got, "Alice")
+	}
+	if got := NullToZero(sql.Null[string]{V: "Alice"}); got != "" {
+		t.Errorf("NullToZero(invalid string) = %q, want empty", got)
+	}
+}
+
+func TestNullToPtr(t *testing.T) {
+	if got := NullToPtr(sql.Null[int]{V: 42, Valid: true}); got == nil || *got != 42 {
+		t.Errorf("NullToPtr(valid int) = %v, want 42", got)
+	}
+	if got := NullToPtr(sql.Null[string]{V: "Alice"}); got != nil {
+		t.Errorf("NullToPtr(invalid string) = %q, want nil", *got)
+	}
+}
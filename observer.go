@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// クエリを実行するたびに SQL, かかった時間, エラーを受け取る
+// OpenTelemetry などに依存せず, 自前のメトリクスに流したいときに使う
+type QueryObserver func(query string, dur time.Duration, err error)
+
+// LoggingDB と同じく sqlx.ExtContext を包み, 実行後に Observer を呼ぶ
+type ObservedDB struct {
+	sqlx.ExtContext
+	Observer QueryObserver
+}
+
+var _ sqlx.ExtContext = (*ObservedDB)(nil)
+
+func NewObservedDB(db sqlx.ExtContext, observer QueryObserver) *ObservedDB {
+	return &ObservedDB{ExtContext: db, Observer: observer}
+}
+
+func (o *ObservedDB) observe(query string, start time.Time, err error) {
+	if o.Observer != nil {
+		o.Observer(query, time.Since(start), err)
+	}
+}
+
+func (o *ObservedDB) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	start := time.Now()
+	rows, err := o.ExtContext.QueryContext(ctx, query, args...)
+	o.observe(query, start, err)
+	return rows, err
+}
+
+// rows を読む時間は含まない
+func (o *ObservedDB) QueryxContext(ctx context.Context, query string, args ...any) (*sqlx.Rows, error) {
+	start := time.Now()
+	rows, err := o.ExtContext.QueryxContext(ctx, query, args...)
+	o.observe(query, start, err)
+	return rows, err
+}
+
+func (o *ObservedDB) QueryRowxContext(ctx context.Context, query string, args ...any) *sqlx.Row {
+	start := time.Now()
+	row := o.ExtContext.QueryRowxContext(ctx, query, args...)
+	// クエリ自体のエラーは Row に保持されている. 該当行がないことは Scan するまで分からない
+	o.observe(query, start, row.Err())
+	return row
+}
+
+func (o *ObservedDB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	start := time.Now()
+	result, err := o.ExtContext.ExecContext(ctx, query, args...)
+	o.observe(query, start, err)
+	return result, err
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestObservedDB(t *testing.T) {
+	type call struct {
+		query string
+		dur   time.Duration
+		err   error
+	}
+	var calls []call
+	db := NewObservedDB(newSeededTestDB(t), func(query string, dur time.Duration, err error) {
+		calls = append(calls, call{query, dur, err})
+	})
+
+	if _, err := GetUserByID(context.Background(), db, 1); err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != 1 {
+		t.Fatalf("observer called %d times, want 1", len(calls))
+	}
+	c := calls[0]
+	if !strings.Contains(c.query, "FROM users WHERE") {
+		t.Errorf("query = %q, want the expanded SELECT", c.query)
+	}
+	if c.dur < 0 {
+		t.Errorf("duration = %v, want >= 0", c.dur)
+	}
+	if c.err != nil {
+		t.Errorf("err = %v, want nil", c.err)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// LIMIT に渡す値を返す. 0 は件数制限なしとして扱う
+// SQLite では OFFSET 単体で書けず, 負の LIMIT は Postgres でエラーになるので, 最大値で無制限にする
+func sqlLimit(limit int) int {
+	if limit == 0 {
+		return math.MaxInt64
+	}
+	return limit
+}
+
+// limit が 0 なら件数制限なし, 負の値はエラー
+// ページ間で順序が変わらないように id 順で固定する
+func SelectUsersPaged(ctx context.Context, db sqlx.ExtContext, limit, offset int) ([]User, error) {
+	if limit < 0 || offset < 0 {
+		return nil, fmt.Errorf("invalid pagination: limit=%d offset=%d", limit, offset)
+	}
+
+	users := []User{}
+	query := "SELECT " + userColumns + " FROM {users} WHERE deleted_at IS NULL ORDER BY id LIMIT ? OFFSET ?"
+	if err := selectContext(ctx, db, &users, query, sqlLimit(limit), offset); err != nil {
+		return nil, fmt.Errorf("SelectUsersPaged: %w", err)
+	}
+	return users, nil
+}
+
+// keyset ページネーション
+// 途中で行が増減しても, 最後に見た id より後ろを取るのでページ間で重複や抜けが起きない
+// 最初のページは afterID に 0 を渡す
+func SelectUsersAfter(ctx context.Context, db sqlx.ExtContext, afterID int, limit int) ([]User, error) {
+	if limit < 0 {
+		return nil, fmt.Errorf("invalid pagination: limit=%d", limit)
+	}
+
+	users := []User{}
+	query := "SELECT " + userColumns + " FROM {users} WHERE deleted_at IS NULL AND id > ? ORDER BY id LIMIT ?"
+	if err := selectContext(ctx, db, &users, query, afterID, sqlLimit(limit)); err != nil {
+		return nil, fmt.Errorf("SelectUsersAfter: %w", err)
+	}
+	return users, nil
+}
+
+type Page[T any] struct {
+	Items   []T  `json:"items"`
+	Total   int  `json:"total"`
+	Limit   int  `json:"limit"`
+	Offset  int  `json:"offset"`
+	HasNext bool `json:"has_next"`
+}
+
+// baseQuery の総件数と, そのうち limit/offset の範囲の行をまとめて返す
+// baseQuery には LIMIT を付けず, ページ間で順序が変わらないよう ORDER BY を含めること
+// limit の扱いは SelectUsersPaged と同じ
+func Paginate[T any](ctx context.Context, db sqlx.ExtContext, baseQuery string, limit, offset int, args ...any) (Page[T], error) {
+	if limit < 0 || offset < 0 {
+		return Page[T]{}, fmt.Errorf("invalid pagination: limit=%d offset=%d", limit, offset)
+	}
+
+	var total int
+	// Postgres ではサブクエリに別名が必要
+	countQuery := "SELECT COUNT(*) FROM (" + baseQuery + ") AS t"
+	if err := getContext(ctx, db, &total, countQuery, args...); err != nil {
+		return Page[T]{}, fmt.Errorf("Paginate.count: %w", err)
+	}
+
+	items := []T{}
+	query := baseQuery + " LIMIT ? OFFSET ?"
+	if err := selectContext(ctx, db, &items, query, slices.Concat(args, []any{sqlLimit(limit), offset})...); err != nil {
+		return Page[T]{}, fmt.Errorf("Paginate.select: %w", err)
+	}
+
+	return Page[T]{
+		Items:   items,
+		Total:   total,
+		Limit:   limit,
+		Offset:  offset,
+		HasNext: offset+len(items) < total,
+	}, nil
+}
+
+// HTTP のレスポンスヘッダに載せるページの情報を返す (net/http には依存しない)
+// X-Total-Count に総件数, Link に first, prev, next, last の URL を RFC 5988 の形式で入れる
+// URL は baseURL のクエリに limit と offset を上書きして作る
+// limit が 0 (件数制限なし) なら 1 ページしかないので Link は付けない
+func (p Page[T]) Headers(baseURL string) (map[string]string, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("Page.Headers: %w", err)
+	}
+	headers := map[string]string{"X-Total-Count": strconv.Itoa(p.Total)}
+	if p.Limit == 0 {
+		return headers, nil
+	}
+
+	link := func(offset int, rel string) string {
+		query := u.Query()
+		query.Set("limit", strconv.Itoa(p.Limit))
+		query.Set("offset", strconv.Itoa(offset))
+		l := *u
+		l.RawQuery = query.Encode()
+		return fmt.Sprintf(`<%s>; rel="%s"`, l.String(), rel)
+	}
+	links := []string{link(0, "first")}
+	if p.Offset > 0 {
+		links = append(links, link(max(p.Offset-p.Limit, 0), "prev"))
+	}
+	if p.HasNext {
+		links = append(links, link(p.Offset+p.Limit, "next"))
+	}
+	if p.Total > 0 {
+		links = append(links, link((p.Total-1)/p.Limit*p.Limit, "last"))
+	}
+	headers["Link"] = strings.Join(links, ", ")
+	return headers, nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func userIDs(users []User) []int {
+	ids := make([]int, len(users))
+	for i, u := range users {
+		ids[i] = u.ID
+	}
+	return ids
+}
+
+func TestSelectUsersPaged(t *testing.T) {
+	db := newTestDB(t)
+	insertUsers(t, db, 5)
+
+	// 2 ページ目 (limit 2)
+	users, err := SelectUsersPaged(context.Background(), db, 2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := userIDs(users), []int{3, 4}; !slices.Equal(got, want) {
+		t.Errorf("ids = %v, want %v", got, want)
+	}
+}
+
+func TestSelectUsersAfter(t *testing.T) {
+	db := newTestDB(t)
+	insertUsers(t, db, 6)
+	ctx := context.Background()
+
+	first, err := SelectUsersAfter(ctx, db, 0, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first) != 3 {
+		t.Fatalf("first page = %v, want 3 users", first)
+	}
+	second, err := SelectUsersAfter(ctx, db, first[len(first)-1].ID, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := append(userIDs(first), userIDs(second)...)
+	if want := []int{1, 2, 3, 4, 5, 6}; !slices.Equal(got, want) {
+		t.Errorf("ids = %v, want %v", got, want)
+	}
+}
+
+func TestPaginate(t *testing.T) {
+	db := newTestDB(t)
+	insertUsers(t, db, 5)
+
+	page, err := Paginate[User](context.Background(), db, "SELECT * FROM users ORDER BY id", 2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 5 {
+		t.Errorf("Total = %d, want 5", page.Total)
+	}
+	if got, want := userIDs(page.Items), []int{3, 4}; !slices.Equal(got, want) {
+		t.Errorf("ids = %v, want %v", got, want)
+	}
+	if !page.HasNext {
+		t.Error("HasNext = false, want true")
+	}
+}
+
+func TestPageHeaders(t *testing.T) {
+	page := Page[User]{Total: 5, Limit: 2, Offset: 2, HasNext: true}
+
+	headers, err := page.Headers("https://example.com/users?sort=name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := headers["X-Total-Count"]; got != "5" {
+		t.Errorf("X-Total-Count = %q, want %q", got, "5")
+	}
+	link := headers["Link"]
+	for _, want := range []string{
+		`<https://example.com/users?limit=2&offset=0&sort=name>; rel="prev"`,
+		`<https://example.com/users?limit=2&offset=4&sort=name>; rel="next"`,
+		`<https://example.com/users?limit=2&offset=4&sort=name>; rel="last"`,
+	} {
+		if !strings.Contains(link, want) {
+			t.Errorf("Link = %q, want it to contain %q", link, want)
+		}
+	}
+}
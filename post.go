@@ -0,0 +1,89 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+type PostStatus string
+
+const (
+	PostStatusDraft     PostStatus = "draft"
+	PostStatusPublished PostStatus = "published"
+	PostStatusArchived  PostStatus = "archived"
+)
+
+func (s PostStatus) Valid() bool {
+	switch s {
+	case PostStatusDraft, PostStatusPublished, PostStatusArchived:
+		return true
+	}
+	return false
+}
+
+// 空文字は未指定として NULL を渡す. INSERT ではカラムの DEFAULT と同じ draft になる (insertPostsQuery)
+// 知らない値は DB に渡す前にエラーにするので, どの INSERT/UPDATE からでも弾かれる
+func (s PostStatus) Value() (driver.Value, error) {
+	if s == "" {
+		return nil, nil
+	}
+	if !s.Valid() {
+		return nil, fmt.Errorf("invalid post status: %q", s)
+	}
+	return string(s), nil
+}
+
+func (s *PostStatus) Scan(src any) error {
+	var v PostStatus
+	switch src := src.(type) {
+	case string:
+		v = PostStatus(src)
+	case []byte:
+		v = PostStatus(src)
+	default:
+		return fmt.Errorf("cannot scan %T into PostStatus", src)
+	}
+	if !v.Valid() {
+		return fmt.Errorf("invalid post status: %q", v)
+	}
+	*s = v
+	return nil
+}
+
+// posts.metadata に JSON の文字列として保存する任意のデータ
+type PostMetadata map[string]any
+
+// nil は NULL として保存する
+func (m PostMetadata) Value() (driver.Value, error) {
+	if m == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		return nil, fmt.Errorf("PostMetadata.Value: %w", err)
+	}
+	return string(b), nil
+}
+
+// NULL は nil になる
+func (m *PostMetadata) Scan(src any) error {
+	var b []byte
+	switch src := src.(type) {
+	case nil:
+		*m = nil
+		return nil
+	case string:
+		b = []byte(src)
+	case []byte:
+		b = src
+	default:
+		return fmt.Errorf("cannot scan %T into PostMetadata", src)
+	}
+	var v PostMetadata
+	if err := json.Unmarshal(b, &v); err != nil {
+		return fmt.Errorf("PostMetadata.Scan: %w", err)
+	}
+	*m = v
+	return nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// post を 1 件入れて読み直す
+func insertAndSelectPost(t *testing.T, db *sqlx.DB, p Post) Post {
+	t.Helper()
+	ctx := context.Background()
+	if _, _, err := BulkInsert(ctx, db, nil, []Post{p}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := SelectOne[Post](ctx, db, "SELECT * FROM posts WHERE user_id = ? AND content = ?", p.UserID, p.Content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return got
+}
+
+func TestPostStatusRoundTrip(t *testing.T) {
+	db := newSeededTestDB(t)
+
+	tests := []struct {
+		status PostStatus
+		want   PostStatus
+	}{
+		{PostStatusDraft, PostStatusDraft},
+		{PostStatusPublished, PostStatusPublished},
+		{PostStatusArchived, PostStatusArchived},
+		{"", PostStatusPublished},
+	}
+	for _, tt := range tests {
+		got := insertAndSelectPost(t, db, Post{UserID: 3, Content: "status " + string(tt.status), Status: tt.status})
+		if got.Status != tt.want {
+			t.Errorf("status %q read back as %q, want %q", tt.status, got.Status, tt.want)
+		}
+	}
+
+	if _, _, err := BulkInsert(context.Background(), db, nil, []Post{{UserID: 3, Content: "bogus", Status: "bogus"}}); err == nil {
+		t.Error("BulkInsert accepted the status \"bogus\"")
+	}
+}
+
+func TestPostStatusColumnDefault(t *testing.T) {
+	db := newSeededTestDB(t)
+	ctx := context.Background()
+
+	// BulkInsert 以外は status を埋めないので, カラムの DEFAULT になる
+	if err := InsertPostsForUser(ctx, db, 3, []string{"Hello, Charlie"}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := SelectOne[Post](ctx, db, "SELECT * FROM posts WHERE user_id = 3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != PostStatusDraft {
+		t.Errorf("Status = %q, want %q", got.Status, PostStatusDraft)
+	}
+}
+
+func TestUpsertPost(t *testing.T) {
+	db := newSeededTestDB(t)
+	ctx := context.Background()
+
+	first, err := UpsertPost(ctx, db, Post{UserID: 1, Content: "Hello, Alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := UpsertPost(ctx, db, Post{UserID: 1, Content: "Hello, Alice", Status: PostStatusArchived})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != 1 || second != 1 {
+		t.Errorf("UpsertPost ids = %d, %d, want the existing post 1", first, second)
+	}
+
+	var count int
+	if err := db.Get(&count, "SELECT COUNT(*) FROM posts WHERE user_id = 1 AND content = 'Hello, Alice'"); err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("rows = %d, want 1", count)
+	}
+
+	// status を指定しなければ archived のまま
+	if _, err := UpsertPost(ctx, db, Post{UserID: 1, Content: "Hello, Alice"}); err != nil {
+		t.Fatal(err)
+	}
+	var status PostStatus
+	if err := db.Get(&status, "SELECT status FROM posts WHERE id = 1"); err != nil {
+		t.Fatal(err)
+	}
+	if status != PostStatusArchived {
+		t.Errorf("status = %q, want %q", status, PostStatusArchived)
+	}
+}
+
+func TestPostMetadataRoundTrip(t *testing.T) {
+	db := newSeededTestDB(t)
+
+	got := insertAndSelectPost(t, db, Post{UserID: 3, Content: "tagged", Metadata: PostMetadata{"tags": []any{"a", "b"}}})
+	if want := (PostMetadata{"tags": []any{"a", "b"}}); !reflect.DeepEqual(got.Metadata, want) {
+		t.Errorf("Metadata = %#v, want %#v", got.Metadata, want)
+	}
+
+	got = insertAndSelectPost(t, db, Post{UserID: 3, Content: "untagged"})
+	if got.Metadata != nil {
+		t.Errorf("Metadata = %#v, want nil", got.Metadata)
+	}
+}
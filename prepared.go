@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// 同じ INSERT を繰り返す場合は一度だけ prepare して使い回す
+type PreparedInserter struct {
+	stmt *sqlx.NamedStmt
+}
+
+func NewPreparedInserter(ctx context.Context, db *sqlx.DB) (*PreparedInserter, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	// LastInsertId は Postgres で使えないので RETURNING で受け取る
+	stmt, err := db.PrepareNamedContext(ctx, expandTables(insertUsersQuery+" RETURNING id"))
+	if err != nil {
+		return nil, fmt.Errorf("NewPreparedInserter: %w", err)
+	}
+	return &PreparedInserter{stmt: stmt}, nil
+}
+
+func (p *PreparedInserter) InsertUser(ctx context.Context, u User) (int, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	if err := u.Validate(); err != nil {
+		return 0, fmt.Errorf("PreparedInserter.InsertUser: %w", err)
+	}
+	now := time.Now()
+	u.CreatedAt, u.UpdatedAt = now, now
+	var id int
+	err := p.stmt.GetContext(ctx, &id, u)
+	recordQuery(err)
+	if err != nil {
+		return 0, fmt.Errorf("PreparedInserter.InsertUser: %w", asConflictError(err))
+	}
+	return id, nil
+}
+
+func (p *PreparedInserter) Close() error {
+	return p.stmt.Close()
+}
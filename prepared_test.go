@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestPreparedInserter(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+
+	p, err := NewPreparedInserter(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	for _, name := range []string{"Alice", "Bob", "Charlie"} {
+		if _, err := p.InsertUser(ctx, User{Name: name}); err != nil {
+			t.Fatalf("InsertUser(%q): %v", name, err)
+		}
+	}
+	if _, err := p.InsertUser(ctx, User{Name: " "}); !errors.Is(err, ErrInvalidUser) {
+		t.Errorf("InsertUser with an empty name error = %v, want ErrInvalidUser", err)
+	}
+
+	users, err := SelectUsers(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 3 {
+		t.Errorf("SelectUsers = %v, want 3 users", users)
+	}
+}
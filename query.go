@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// 結果を受け取る変数を宣言せずに Select する
+// 該当行がなくても nil ではなく空のスライスを返す
+func SelectAll[T any](ctx context.Context, db sqlx.QueryerContext, query string, args ...any) ([]T, error) {
+	rows := []T{}
+	if err := selectContext(ctx, db, &rows, query, args...); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// 該当行がなければ Get と同じく sql.ErrNoRows を返す
+func SelectOne[T any](ctx context.Context, db sqlx.QueryerContext, query string, args ...any) (T, error) {
+	var row T
+	if err := getContext(ctx, db, &row, query, args...); err != nil {
+		var zero T
+		return zero, err
+	}
+	return row, nil
+}
+
+// sqlx.In で arg のスライスを ?, ?, ... に展開してから dest に Select する
+// プレースホルダの書き換えは selectContext が行うので, query は ? で書けばいい
+// 空のスライスを渡すと sqlx.In がエラーを返すので, 呼び出し元で先に弾くこと
+func InSelect[T any](ctx context.Context, db sqlx.QueryerContext, query string, arg any, dest *[]T) error {
+	query, args, err := sqlx.In(query, arg)
+	if err != nil {
+		return err
+	}
+	return selectContext(ctx, db, dest, query, args...)
+}
+
+// InSelect の Exec 版
+func InExec(ctx context.Context, db sqlx.ExecerContext, query string, arg any) (sql.Result, error) {
+	query, args, err := sqlx.In(query, arg)
+	if err != nil {
+		return nil, err
+	}
+	return execContext(ctx, db, query, args...)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestSelectAllAndSelectOne(t *testing.T) {
+	db := newSeededTestDB(t)
+	ctx := context.Background()
+
+	users, err := SelectAll[User](ctx, db, "SELECT * FROM users ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := userNames(users), []string{"Alice", "Bob", "Charlie"}; !slices.Equal(got, want) {
+		t.Errorf("SelectAll = %v, want %v", got, want)
+	}
+	empty, err := SelectAll[User](ctx, db, "SELECT * FROM users WHERE id = ?", 999)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if empty == nil || len(empty) != 0 {
+		t.Errorf("SelectAll with no rows = %#v, want an empty slice", empty)
+	}
+
+	user, err := SelectOne[User](ctx, db, "SELECT * FROM users WHERE id = ?", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Name != "Bob" {
+		t.Errorf("SelectOne = %+v, want Bob", user)
+	}
+	if _, err := SelectOne[User](ctx, db, "SELECT * FROM users WHERE id = ?", 999); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("SelectOne(999) error = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestInSelect(t *testing.T) {
+	db := newSeededTestDB(t)
+	ctx := context.Background()
+
+	var users []User
+	if err := InSelect(ctx, db, "SELECT "+userColumns+" FROM {users} WHERE id IN (?) ORDER BY id", []int{1, 3}, &users); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := userNames(users), []string{"Alice", "Charlie"}; !slices.Equal(got, want) {
+		t.Errorf("InSelect = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// テストなどで sqlite を使わずに差し替えられるようにするためのインターフェース
+type UserRepository interface {
+	Create(ctx context.Context, u User) (int, error)
+	GetByID(ctx context.Context, id int) (User, error)
+	List(ctx context.Context) ([]User, error)
+	Update(ctx context.Context, u User) (int64, error)
+	Delete(ctx context.Context, id int) error
+}
+
+type sqlxUserRepository struct {
+	db *sqlx.DB
+}
+
+var _ UserRepository = (*sqlxUserRepository)(nil)
+
+func NewUserRepository(db *sqlx.DB) UserRepository {
+	return &sqlxUserRepository{db: db}
+}
+
+func (r *sqlxUserRepository) Create(ctx context.Context, u User) (int, error) {
+	return CreateUser(ctx, r.db, u.Name)
+}
+
+func (r *sqlxUserRepository) GetByID(ctx context.Context, id int) (User, error) {
+	return GetUserByID(ctx, r.db, id)
+}
+
+func (r *sqlxUserRepository) List(ctx context.Context) ([]User, error) {
+	return SelectUsers(ctx, r.db)
+}
+
+func (r *sqlxUserRepository) Update(ctx context.Context, u User) (int64, error) {
+	return UpdateUser(ctx, r.db, u)
+}
+
+func (r *sqlxUserRepository) Delete(ctx context.Context, id int) error {
+	return DeleteUser(ctx, r.db, id)
+}
+
+// UserRepository と同じ操作を呼び出し元のトランザクションの中で行う
+// 複数の操作を WithTx でまとめて, 途中で失敗したら全部ロールバックしたいときに使う
+//
+//	err := WithTx(ctx, db, func(tx *sqlx.Tx) error {
+//		id, err := repo.CreateTx(ctx, tx, User{Name: "Dave"})
+//		if err != nil {
+//			return err
+//		}
+//		return repo.InsertPostsTx(ctx, tx, id, []string{"Hello, Dave"})
+//	})
+type TxUserRepository interface {
+	CreateTx(ctx context.Context, tx *sqlx.Tx, u User) (int, error)
+	GetByIDTx(ctx context.Context, tx *sqlx.Tx, id int) (User, error)
+	ListTx(ctx context.Context, tx *sqlx.Tx) ([]User, error)
+	UpdateTx(ctx context.Context, tx *sqlx.Tx, u User) (int64, error)
+	DeleteTx(ctx context.Context, tx *sqlx.Tx, id int) error
+	InsertPostsTx(ctx context.Context, tx *sqlx.Tx, userID int, contents []string) error
+}
+
+var _ TxUserRepository = (*sqlxUserRepository)(nil)
+
+// NewUserRepository と同じ実装を返す
+func NewTxUserRepository(db *sqlx.DB) TxUserRepository {
+	return &sqlxUserRepository{db: db}
+}
+
+func (r *sqlxUserRepository) CreateTx(ctx context.Context, tx *sqlx.Tx, u User) (int, error) {
+	return CreateUser(ctx, tx, u.Name)
+}
+
+func (r *sqlxUserRepository) GetByIDTx(ctx context.Context, tx *sqlx.Tx, id int) (User, error) {
+	return GetUserByID(ctx, tx, id)
+}
+
+func (r *sqlxUserRepository) ListTx(ctx context.Context, tx *sqlx.Tx) ([]User, error) {
+	return SelectUsers(ctx, tx)
+}
+
+func (r *sqlxUserRepository) UpdateTx(ctx context.Context, tx *sqlx.Tx, u User) (int64, error) {
+	return UpdateUser(ctx, tx, u)
+}
+
+func (r *sqlxUserRepository) DeleteTx(ctx context.Context, tx *sqlx.Tx, id int) error {
+	return DeleteUser(ctx, tx, id)
+}
+
+func (r *sqlxUserRepository) InsertPostsTx(ctx context.Context, tx *sqlx.Tx, userID int, contents []string) error {
+	return insertPostsForUserTx(ctx, tx, userID, contents)
+}
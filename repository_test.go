@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// sqlite を使わない UserRepository
+type fakeUserRepository struct {
+	users  map[int]User
+	nextID int
+}
+
+var _ UserRepository = (*fakeUserRepository)(nil)
+
+func newFakeUserRepository() *fakeUserRepository {
+	return &fakeUserRepository{users: map[int]User{}, nextID: 1}
+}
+
+func (r *fakeUserRepository) Create(_ context.Context, u User) (int, error) {
+	if err := u.Validate(); err != nil {
+		return 0, err
+	}
+	u.ID = r.nextID
+	r.nextID++
+	r.users[u.ID] = u
+	return u.ID, nil
+}
+
+func (r *fakeUserRepository) GetByID(_ context.Context, id int) (User, error) {
+	u, ok := r.users[id]
+	if !ok {
+		return User{}, ErrUserNotFound
+	}
+	return u, nil
+}
+
+func (r *fakeUserRepository) List(context.Context) ([]User, error) {
+	users := []User{}
+	for _, u := range r.users {
+		users = append(users, u)
+	}
+	slices.SortFunc(users, func(a, b User) int { return a.ID - b.ID })
+	return users, nil
+}
+
+func (r *fakeUserRepository) Update(_ context.Context, u User) (int64, error) {
+	if _, ok := r.users[u.ID]; !ok {
+		return 0, nil
+	}
+	r.users[u.ID] = u
+	return 1, nil
+}
+
+func (r *fakeUserRepository) Delete(_ context.Context, id int) error {
+	delete(r.users, id)
+	return nil
+}
+
+// 実装によらず同じ結果になることを確かめる
+func testUserRepository(t *testing.T, repo UserRepository) {
+	ctx := context.Background()
+
+	id, err := repo.Create(ctx, User{Name: "Alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Update(ctx, User{ID: id, Name: "Alicia"}); err != nil {
+		t.Fatal(err)
+	}
+	user, err := repo.GetByID(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Name != "Alicia" {
+		t.Errorf("Name = %q, want %q", user.Name, "Alicia")
+	}
+
+	if err := repo.Delete(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.GetByID(ctx, id); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("GetByID after Delete error = %v, want ErrUserNotFound", err)
+	}
+	users, err := repo.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 0 {
+		t.Errorf("List = %v, want empty", users)
+	}
+}
+
+func TestUserRepository(t *testing.T) {
+	t.Run("fake", func(t *testing.T) {
+		testUserRepository(t, newFakeUserRepository())
+	})
+	t.Run("sqlx", func(t *testing.T) {
+		testUserRepository(t, NewUserRepository(newTestDB(t)))
+	})
+}
+
+func TestTxUserRepositoryRollback(t *testing.T) {
+	db := newTestDB(t)
+	repo := NewTxUserRepository(db)
+	ctx := context.Background()
+	errFail := errors.New("fail")
+
+	err := WithTx(ctx, db, func(tx *sqlx.Tx) error {
+		id, err := repo.CreateTx(ctx, tx, User{Name: "Dave"})
+		if err != nil {
+			return err
+		}
+		if err := repo.InsertPostsTx(ctx, tx, id, []string{"Hello, Dave"}); err != nil {
+			return err
+		}
+		// 同じトランザクションの中では見える
+		if _, err := repo.GetByIDTx(ctx, tx, id); err != nil {
+			return err
+		}
+		return errFail
+	})
+	if !errors.Is(err, errFail) {
+		t.Fatalf("WithTx error = %v, want %v", err, errFail)
+	}
+
+	if users, posts := countRows(t, db); users != 0 || posts != 0 {
+		t.Errorf("users = %d, posts = %d, want both rolled back", users, posts)
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"errors"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+const (
+	defaultRetryAttempts = 5
+	retryBaseDelay       = 10 * time.Millisecond
+)
+
+// 同時に書き込むと SQLite は SQLITE_BUSY ("database is locked") を返すので, その場合だけ待ってやり直す
+// go-sqlite3 は busy_timeout (デフォルト 5 秒) までは待つので, それでもロックが取れなかったときの保険
+// 待ち時間は 10ms, 20ms, 40ms, ... と倍にしていく
+func withRetry(attempts int, fn func() error) error {
+	var err error
+	delay := retryBaseDelay
+	for i := 0; i < attempts; i++ {
+		if err = fn(); err == nil || !isLockError(err) {
+			return err
+		}
+		if i < attempts-1 {
+			time.Sleep(delay)
+			delay *= 2
+		}
+	}
+	return err
+}
+
+func isLockError(err error) bool {
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	return sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked
+}
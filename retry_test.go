@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/mattn/go-sqlite3"
+)
+
+func TestWithRetry(t *testing.T) {
+	t.Run("lock error", func(t *testing.T) {
+		calls := 0
+		err := withRetry(defaultRetryAttempts, func() error {
+			calls++
+			if calls < 3 {
+				return sqlite3.Error{Code: sqlite3.ErrBusy}
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if calls != 3 {
+			t.Errorf("calls = %d, want 3", calls)
+		}
+	})
+	t.Run("other error", func(t *testing.T) {
+		calls := 0
+		errFail := errors.New("fail")
+		err := withRetry(defaultRetryAttempts, func() error {
+			calls++
+			return errFail
+		})
+		if !errors.Is(err, errFail) {
+			t.Errorf("withRetry error = %v, want %v", err, errFail)
+		}
+		if calls != 1 {
+			t.Errorf("calls = %d, want 1", calls)
+		}
+	})
+}
+
+func TestConcurrentWritesRetry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, err := InitDB("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+	if err := Migrate(ctx, db, SchemaMigrations(DialectFor(db.DriverName()))); err != nil {
+		t.Fatal(err)
+	}
+
+	// busy_timeout の間は SQLite 自身がロックを待ってしまうので, 書き込む側は待たずに SQLITE_BUSY を返す接続にする
+	writer, err := sqlx.Open("sqlite3", path+"?_busy_timeout=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer writer.Close()
+
+	// 別の接続で書き込みロックを取っておく
+	holder, err := db.Connx(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer holder.Close()
+	if _, err := holder.ExecContext(ctx, "BEGIN IMMEDIATE"); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := BulkInsert(ctx, writer, []User{{Name: "Alice"}}, nil)
+		done <- err
+	}()
+	// 1 回目の INSERT はロックが取れずに失敗する. 残りの待ち時間 (10ms + 20ms + ...) のうちにロックを放す
+	time.Sleep(2 * retryBaseDelay)
+	if _, err := holder.ExecContext(ctx, "COMMIT"); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("BulkInsert error = %v, want it to succeed after retrying", err)
+	}
+
+	count, err := CountUsers(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("CountUsers = %d, want 1", count)
+	}
+}
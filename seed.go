@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// デモ用のデータを入れる
+// posts の user_id は users が 1 から採番される前提なので, Migrate した直後の空の DB に対して使う
+func Seed(ctx context.Context, db sqlx.ExtContext) error {
+	users := []User{
+		{Name: "Alice"},
+		{Name: "Bob"},
+		{Name: "Charlie"},
+	}
+	// Alice has 2 posts, Bob has 1 post, Charlie has no post
+	posts := []Post{
+		{UserID: 1, Content: "Hello, Alice"},
+		{UserID: 1, Content: "Nice to meet you"},
+		{UserID: 2, Content: "Hello, Bob"},
+	}
+	if _, _, err := BulkInsert(ctx, db, users, posts); err != nil {
+		return fmt.Errorf("Seed: %w", err)
+	}
+	return nil
+}
+
+// LoadFixtures で入れるデータ
+// Posts の UserID は Users に採番される id を前提に書く
+type Fixtures struct {
+	Users []User
+	Posts []Post
+}
+
+// Seed のデータを差し替えられるようにしたもの
+// 外部キー制約に引っかからないよう users, posts の順に入れ, どちらかが失敗したら全部ロールバックする
+func LoadFixtures(ctx context.Context, db *sqlx.DB, f Fixtures) error {
+	if err := BulkInsertTx(ctx, db, f.Users, f.Posts); err != nil {
+		return fmt.Errorf("LoadFixtures: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// users と posts の件数 (論理削除された users も含む)
+func countRows(t *testing.T, db *sqlx.DB) (users, posts int) {
+	t.Helper()
+	if err := db.Get(&users, "SELECT COUNT(*) FROM users"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Get(&posts, "SELECT COUNT(*) FROM posts"); err != nil {
+		t.Fatal(err)
+	}
+	return users, posts
+}
+
+func TestSeed(t *testing.T) {
+	db := newTestDB(t)
+
+	if err := Seed(context.Background(), db); err != nil {
+		t.Fatal(err)
+	}
+	if users, posts := countRows(t, db); users != 3 || posts != 3 {
+		t.Errorf("users = %d, posts = %d, want 3 and 3", users, posts)
+	}
+}
+
+func TestLoadFixtures(t *testing.T) {
+	db := newTestDB(t)
+	f := Fixtures{
+		Users: []User{{Name: "Dave"}, {Name: "Eve"}},
+		Posts: []Post{
+			{UserID: 1, Content: "Hello, Dave"},
+			{UserID: 2, Content: "Hello, Eve"},
+			{UserID: 2, Content: "Bye, Eve"},
+		},
+	}
+
+	if err := LoadFixtures(context.Background(), db, f); err != nil {
+		t.Fatal(err)
+	}
+	if users, posts := countRows(t, db); users != 2 || posts != 3 {
+		t.Errorf("users = %d, posts = %d, want 2 and 3", users, posts)
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import "strings"
+
+// テーブル名の接頭辞. "t1_" にすると users は t1_users になる
+// 同じ DB の中でテストごとにテーブルを分けたいときに使う
+// クエリを実行するたびに読むので, DB を使い始める前に設定して途中で変えない
+var TablePrefix string
+
+// クエリの中の {users} のような部分を接頭辞付きのテーブル名に置き換える
+// SQL に埋め込むのは TablePrefix (設定値) とここに並べた名前だけで, 利用者の入力は入らない
+var tableNames = []string{"users", "posts", "counters", "schema_migrations"}
+
+// 接頭辞付きのテーブル名
+func Table(name string) string {
+	return TablePrefix + name
+}
+
+// selectContext などの DB にアクセスするヘルパーは全てこれを通すので, 各関数のクエリは {users} と書くだけでいい
+func expandTables(query string) string {
+	if !strings.Contains(query, "{") {
+		return query
+	}
+	oldnew := make([]string, 0, len(tableNames)*2)
+	for _, name := range tableNames {
+		oldnew = append(oldnew, "{"+name+"}", Table(name))
+	}
+	return strings.NewReplacer(oldnew...).Replace(query)
+}
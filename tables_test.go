@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestTablePrefix(t *testing.T) {
+	TablePrefix = "t1_"
+	t.Cleanup(func() { TablePrefix = "" })
+	db := newSeededTestDB(t)
+
+	var tables []string
+	if err := db.Select(&tables, "SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name"); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"t1_counters", "t1_posts", "t1_schema_migrations", "t1_users"}; !slices.Equal(tables, want) {
+		t.Errorf("tables = %v, want %v", tables, want)
+	}
+
+	users, err := SelectUsers(context.Background(), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 3 {
+		t.Errorf("SelectUsers = %v, want 3 users", users)
+	}
+
+	// JOIN では別名の users.id などで参照するので, 接頭辞が付いても動く
+	rows, err := LeftJoinQuery(context.Background(), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 4 {
+		t.Errorf("LeftJoinQuery = %v, want 4 rows", rows)
+	}
+	if _, err := JoinQuery(context.Background(), db); err != nil {
+		t.Fatal(err)
+	}
+}
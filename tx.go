@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// fn が nil を返せば Commit, エラーを返すか panic したら Rollback する
+// panic は Rollback した後にそのまま投げ直す
+//
+// ctx がキャンセルされるかタイムアウトすると, fn が止まっていても database/sql が裏で Rollback して接続をプールに戻す
+// fn の中では tx に同じ ctx を渡すこと (渡さないとクエリがキャンセルされずに待ち続ける)
+//
+// DefaultQueryTimeout は 1 クエリごとの上限なので, トランザクション全体には掛けない
+// fn の中のクエリは selectContext などを通るたびにそれぞれ掛かる. 全体の上限は呼び出し元が ctx で決める
+func WithTx(ctx context.Context, db *sqlx.DB, fn func(tx *sqlx.Tx) error) error {
+	return WithTxOpts(ctx, db, nil, fn)
+}
+
+// WithTx で分離レベルや ReadOnly を指定する
+// opts が nil ならドライバのデフォルトになる
+// ドライバが対応していない分離レベルを指定すると begin でエラーになる
+// go-sqlite3 は ReadOnly を無視するので, SQLite では ReadOnly でも書き込めてしまう (Postgres ならエラーになる)
+func WithTxOpts(ctx context.Context, db *sqlx.DB, opts *sql.TxOptions, fn func(tx *sqlx.Tx) error) error {
+	tx, err := db.BeginTxx(ctx, opts)
+	if err != nil {
+		return fmt.Errorf("WithTx.begin: %w", err)
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		// ctx が原因で失敗すると fn のエラーは sql.ErrTxDone などになって分からないので, ctx のエラーも包む
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return fmt.Errorf("WithTx: %w: %w", ctxErr, err)
+		}
+		return err
+	}
+	// 既に Rollback されているので Commit しても sql.ErrTxDone になるだけ
+	// 何が起きたか分かるように ctx のエラーを返す
+	if err := ctx.Err(); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("WithTx: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("WithTx.commit: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func TestWithTxRollsBackOnError(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	errFail := errors.New("fail")
+
+	err := WithTx(ctx, db, func(tx *sqlx.Tx) error {
+		if _, err := CreateUser(ctx, tx, "Alice"); err != nil {
+			return err
+		}
+		return errFail
+	})
+	if !errors.Is(err, errFail) {
+		t.Fatalf("WithTx error = %v, want %v", err, errFail)
+	}
+
+	count, err := CountUsers(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Errorf("CountUsers = %d, want 0", count)
+	}
+}
+
+func TestWithTxCanceledContext(t *testing.T) {
+	db := newTestDB(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	err := WithTx(ctx, db, func(tx *sqlx.Tx) error {
+		if _, err := CreateUser(ctx, tx, "Alice"); err != nil {
+			return err
+		}
+		// 処理が遅いうちに呼び出し元がキャンセルする
+		cancel()
+		<-ctx.Done()
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("WithTx error = %v, want context.Canceled", err)
+	}
+
+	// 接続は 1 つだけなので, プールに戻っていなければ DefaultQueryTimeout まで待ってエラーになる
+	count, err := CountUsers(context.Background(), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Errorf("CountUsers = %d, want 0", count)
+	}
+	if inUse := db.Stats().InUse; inUse != 0 {
+		t.Errorf("connections in use = %d, want 0", inUse)
+	}
+}
+
+// ReadOnly が効くことは Postgres でしか確かめられないので TestPostgres で見る
+func TestWithTxOpts(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+
+	err := WithTxOpts(ctx, db, &sql.TxOptions{Isolation: sql.LevelSerializable}, func(tx *sqlx.Tx) error {
+		_, err := CreateUser(ctx, tx, "Alice")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count, err := CountUsers(ctx, db); err != nil || count != 1 {
+		t.Errorf("CountUsers = %d, %v, want 1", count, err)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type SortOrder string
+
+const (
+	Asc  SortOrder = "ASC"
+	Desc SortOrder = "DESC"
+)
+
+// ORDER BY の 1 項目
+type OrderBy struct {
+	Column string
+	Order  SortOrder
+}
+
+// "name DESC" のような ORDER BY の 1 項目を返す
+// カラム名は SQL に埋め込むので, allowed にないものはエラーにする
+func (o OrderBy) Clause(allowed []string) (string, error) {
+	if !slices.Contains(allowed, o.Column) {
+		return "", fmt.Errorf("invalid order column: %q", o.Column)
+	}
+	if o.Order != Asc && o.Order != Desc {
+		return "", fmt.Errorf("invalid sort order: %q", o.Order)
+	}
+	return o.Column + " " + string(o.Order), nil
+}
+
+// users に対する SELECT を組み立てる
+// 値は全てプレースホルダで渡し, SQL に埋め込むのは許可したカラム名だけ
+// エラーはメソッドチェーンの途中では返さず, Build でまとめて返す
+type UserQuery struct {
+	where   []string
+	args    []any
+	orderBy []string
+	limit   int
+	offset  int
+	err     error
+}
+
+func NewUserQuery() *UserQuery {
+	return &UserQuery{}
+}
+
+// 前方一致 (% と _ はエスケープされる)
+func (q *UserQuery) WhereNameLike(prefix string) *UserQuery {
+	q.where = append(q.where, `name LIKE ? ESCAPE '\'`)
+	q.args = append(q.args, likeEscaper.Replace(prefix)+"%")
+	return q
+}
+
+// ids が空なら 1 件も一致しない
+func (q *UserQuery) WhereIDIn(ids []int) *UserQuery {
+	if len(ids) == 0 {
+		// sqlx.In は空のスライスを渡すとエラーになるので, 常に偽になる条件にする
+		q.where = append(q.where, "1 = 0")
+		return q
+	}
+	// (?) は Build で sqlx.In がスライスの長さ分に展開する
+	q.where = append(q.where, "id IN (?)")
+	q.args = append(q.args, ids)
+	return q
+}
+
+// 複数回呼ぶと呼んだ順に並べる
+func (q *UserQuery) OrderBy(column string, order SortOrder) *UserQuery {
+	clause, err := OrderBy{Column: column, Order: order}.Clause(userOrderColumns)
+	if err != nil {
+		q.err = err
+		return q
+	}
+	q.orderBy = append(q.orderBy, clause)
+	return q
+}
+
+// 0 なら件数制限なし
+func (q *UserQuery) Limit(n int) *UserQuery {
+	if n < 0 {
+		q.err = fmt.Errorf("invalid limit: %d", n)
+		return q
+	}
+	q.limit = n
+	return q
+}
+
+func (q *UserQuery) Offset(n int) *UserQuery {
+	if n < 0 {
+		q.err = fmt.Errorf("invalid offset: %d", n)
+		return q
+	}
+	q.offset = n
+	return q
+}
+
+// プレースホルダは ? のままなので, selectContext などを通さずに実行するなら db.Rebind する
+// args はプレースホルダの順に並ぶ
+func (q *UserQuery) Build() (string, []any, error) {
+	if q.err != nil {
+		return "", nil, fmt.Errorf("UserQuery.Build: %w", q.err)
+	}
+
+	// 論理削除された user は SelectUsers と同じく常に除く
+	where := append([]string{"deleted_at IS NULL"}, q.where...)
+	query := "SELECT " + userColumns + " FROM {users} WHERE " + strings.Join(where, " AND ")
+	args := append([]any(nil), q.args...)
+	if len(q.orderBy) > 0 {
+		query += " ORDER BY " + strings.Join(q.orderBy, ", ")
+	}
+	if q.limit > 0 || q.offset > 0 {
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, sqlLimit(q.limit), q.offset)
+	}
+
+	query, args, err := sqlx.In(query, args...)
+	if err != nil {
+		return "", nil, fmt.Errorf("UserQuery.Build: %w", err)
+	}
+	return expandTables(query), args, nil
+}
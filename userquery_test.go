@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUserQueryBuild(t *testing.T) {
+	prefix := "SELECT " + userColumns + " FROM users WHERE deleted_at IS NULL"
+	tests := []struct {
+		name      string
+		query     *UserQuery
+		wantQuery string
+		wantArgs  []any
+	}{
+		{"none", NewUserQuery(), "", []any{}},
+		{"name like", NewUserQuery().WhereNameLike("A_"), ` AND name LIKE ? ESCAPE '\'`, []any{`A\_%`}},
+		{"id in", NewUserQuery().WhereIDIn([]int{1, 2}), " AND id IN (?, ?)", []any{1, 2}},
+		{"order by", NewUserQuery().OrderBy("name", Desc), " ORDER BY name DESC", []any{}},
+		{"limit", NewUserQuery().Limit(2), " LIMIT ? OFFSET ?", []any{2, 0}},
+		{"offset", NewUserQuery().Offset(1), " LIMIT ? OFFSET ?", []any{math.MaxInt64, 1}},
+		{
+			"combined",
+			NewUserQuery().WhereNameLike("A").WhereIDIn([]int{1, 2}).OrderBy("id", Asc).Limit(2).Offset(1),
+			` AND name LIKE ? ESCAPE '\' AND id IN (?, ?) ORDER BY id ASC LIMIT ? OFFSET ?`,
+			[]any{"A%", 1, 2, 2, 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, args, err := tt.query.Build()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := prefix + tt.wantQuery; query != want {
+				t.Errorf("query = %q, want %q", query, want)
+			}
+			if strings.Count(query, "?") != len(args) {
+				t.Errorf("%d placeholders for %d args", strings.Count(query, "?"), len(args))
+			}
+			if len(args) == 0 && len(tt.wantArgs) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("args = %v, want %v", args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestUserQueryCombined(t *testing.T) {
+	db := newSeededTestDB(t)
+
+	query, args, err := NewUserQuery().WhereIDIn([]int{1, 2, 3}).OrderBy("id", Desc).Limit(1).Offset(1).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	users, err := SelectAll[User](context.Background(), db, query, args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 || users[0].Name != "Bob" {
+		t.Errorf("users = %v, want [Bob]", users)
+	}
+}
+
+func TestOrderByClause(t *testing.T) {
+	tests := []struct {
+		order   OrderBy
+		want    string
+		wantErr bool
+	}{
+		{OrderBy{Column: "id", Order: Asc}, "id ASC", false},
+		{OrderBy{Column: "name", Order: Desc}, "name DESC", false},
+		{OrderBy{Column: "name; DROP TABLE users", Order: Asc}, "", true},
+		{OrderBy{Column: "id", Order: "sideways"}, "", true},
+	}
+	for _, tt := range tests {
+		got, err := tt.order.Clause(userOrderColumns)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%+v.Clause() error = %v, want error: %v", tt.order, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Errorf("%+v.Clause() = %q, want %q", tt.order, got, tt.want)
+		}
+	}
+}